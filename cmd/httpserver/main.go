@@ -1,8 +1,10 @@
 package main
 
 import (
+	"context"
 	"crypto/sha256"
 	"encoding/hex"
+	"hash"
 	"io"
 	"log"
 	"net/http"
@@ -11,15 +13,16 @@ import (
 	"strconv"
 	"strings"
 	"syscall"
+	"time"
 
-	"github.com/RegistersNinja/httpfromtcp/internal/headers"
 	"github.com/RegistersNinja/httpfromtcp/internal/request"
 	"github.com/RegistersNinja/httpfromtcp/internal/response"
 	"github.com/RegistersNinja/httpfromtcp/internal/server"
 )
 
 const (
-	port int = 42069
+	port            int           = 42069
+	shutdownTimeout time.Duration = 30 * time.Second
 
 	proxyPath string = "https://httpbin.org/"
 
@@ -31,7 +34,6 @@ const (
 	assetVideoFile string = "assets/vim.mp4"
 
 	headerContentType   string = "Content-Type"
-	headerConnection    string = "Connection"
 	headerTransferEnc   string = "Transfer-Encoding"
 	headerTrailer       string = "Trailer"
 	headerContentLength string = "Content-Length"
@@ -41,11 +43,11 @@ const (
 
 	trailerAnnouncement string = trailerContentSHA + ", " + trailerContentLength
 
-	connectionClose         string = "close"
 	transferEncodingChunked string = "chunked"
-	defaultProxyBufferSize  int    = 1024
 
 	contentTypeVideoMP4 string = "video/mp4"
+	contentTypeHTML     string = "text/html; charset=utf-8"
+	contentTypePlain    string = "text/plain"
 )
 
 func respond400() []byte {
@@ -90,106 +92,87 @@ func main() {
 		srv     *server.Server
 		err     error
 		sigChan chan os.Signal
+		ctx     context.Context
+		cancel  context.CancelFunc
 	)
 
-	handler = func(w *response.Writer, req *request.Request) {
+	handler = server.ResponseHandler(func(w *response.ResponseWriter, req *request.Request) {
 		var (
-			status           response.StatusCode
-			hdrs             headers.Headers
-			body             []byte
-			path             string
-			url              string
-			resp             *http.Response
-			ct               string
-			buf              []byte
-			n                int
-			rerr             error
-			handled          bool
-			requestTarget    string
-			trailer          headers.Headers
-			fullBody         []byte
-			hash             [sha256.Size]byte
-			hashString       string
-			contentLenString string
-			videoData        []byte
+			status      response.StatusCode
+			body        []byte
+			path        string
+			url         string
+			upstream    *http.Request
+			resp        *http.Response
+			ct          string
+			requestPath string
+			hasher      hash.Hash
+			copied      int64
+			videoFile   *os.File
+			info        os.FileInfo
+			err         error
 		)
 
-		requestTarget = req.RequestLine.RequestTarget
+		requestPath = req.Path()
 		switch {
-		case strings.HasPrefix(requestTarget, pathHttpbinPrefix):
-			path = strings.TrimPrefix(requestTarget, pathHttpbinPrefix)
+		case strings.HasPrefix(requestPath, pathHttpbinPrefix):
+			path = strings.TrimPrefix(req.Target.RawPath, pathHttpbinPrefix)
 			url = proxyPath + path
+			if req.RawQuery() != "" {
+				url += "?" + req.RawQuery()
+			}
 
-			resp, err = http.Get(url)
+			// The upstream request ends with the client's, so a client that
+			// hangs up stops the download too.
+			upstream, err = http.NewRequestWithContext(req.Context(), http.MethodGet, url, nil)
+			if err == nil {
+				resp, err = http.DefaultClient.Do(upstream)
+			}
 			if err != nil {
 				status = response.StatusInternalServerError
 				body = respond500()
-				hdrs = response.GetDefaultHeaders(len(body))
-				hdrs.OverrideHeaderValue(headerContentLength, strconv.Itoa(len(body)))
-				_ = w.WriteStatusLine(status)
-				_ = w.WriteHeaders(hdrs)
-				_ = w.WriteBody(body)
-				return
+				break
 			}
 			defer resp.Body.Close()
 
-			_ = w.WriteStatusLine(response.StatusOK)
-			hdrs = headers.NewHeaders()
+			// Content-Type is copied from upstream, so clean it rather than
+			// trusting it.
+			w.SetFieldMode(response.FieldSanitize)
 			ct = resp.Header.Get(headerContentType)
 			if ct != "" {
-				hdrs.OverrideHeaderValue(headerContentType, ct)
+				w.Header().Set(headerContentType, ct)
 			}
-			hdrs.OverrideHeaderValue(headerConnection, connectionClose)
-			hdrs.OverrideHeaderValue(headerTransferEnc, transferEncodingChunked)
-			hdrs.OverrideHeaderValue(headerTrailer, trailerAnnouncement)
-			_ = w.WriteHeaders(hdrs)
-
-			buf = make([]byte, defaultProxyBufferSize)
-			for {
-				n, rerr = resp.Body.Read(buf)
-				if n > 0 {
-					fullBody = append(fullBody, buf[:n]...)
-					_, _ = w.WriteChunkedBody(buf[:n])
-				}
-				if rerr == io.EOF {
-					hash = sha256.Sum256(fullBody)
-					hashString = hex.EncodeToString(hash[:])
-					contentLenString = strconv.Itoa(len(fullBody))
-					trailer = headers.NewHeaders()
-					trailer.OverrideHeaderValue(trailerContentSHA, hashString)
-					trailer.OverrideHeaderValue(trailerContentLength, contentLenString)
-					_ = w.WriteTrailers(trailer)
-					break
-				}
-				if rerr != nil {
-					break
-				}
+			w.Header().Set(headerTransferEnc, transferEncodingChunked)
+			w.Header().Set(headerTrailer, trailerAnnouncement)
+
+			hasher = sha256.New()
+			copied, _ = io.Copy(w, io.TeeReader(resp.Body, hasher))
+			w.Trailers().Set(trailerContentSHA, hex.EncodeToString(hasher.Sum(nil)))
+			w.Trailers().Set(trailerContentLength, strconv.FormatInt(copied, 10))
+			return
+
+		case requestPath == pathVideo:
+			videoFile, err = os.Open(assetVideoFile)
+			if err == nil {
+				defer videoFile.Close()
+				info, err = videoFile.Stat()
 			}
-			handled = true
-
-		case requestTarget == pathVideo:
-			videoData, err = os.ReadFile(assetVideoFile)
 			if err != nil {
 				status = response.StatusInternalServerError
 				body = respond500()
 				break
 			}
 
-			status = response.StatusOK
-			hdrs = headers.NewHeaders()
-			hdrs.OverrideHeaderValue(headerContentLength, strconv.Itoa(len(videoData)))
-			hdrs.OverrideHeaderValue(headerConnection, connectionClose)
-			hdrs.OverrideHeaderValue(headerContentType, contentTypeVideoMP4)
-			_ = w.WriteStatusLine(status)
-			_ = w.WriteHeaders(hdrs)
-			_ = w.WriteBody(videoData)
-			handled = true
-
-		case requestTarget == pathYourProblem:
+			w.Header().Set(headerContentLength, strconv.FormatInt(info.Size(), 10))
+			w.Header().Set(headerContentType, contentTypeVideoMP4)
+			_, _ = io.Copy(w, videoFile)
+			return
+
+		case requestPath == pathYourProblem:
 			status = response.StatusBadRequest
 			body = respond400()
 
-		case requestTarget == pathMyProblem:
+		case requestPath == pathMyProblem:
 			status = response.StatusInternalServerError
 			body = respond500()
 
@@ -198,24 +181,34 @@ func main() {
 			body = respond200()
 		}
 
-		if !handled {
-			hdrs = response.GetDefaultHeaders(len(body))
-			hdrs.OverrideHeaderValue(headerContentLength, strconv.Itoa(len(body)))
-			_ = w.WriteStatusLine(status)
-			_ = w.WriteHeaders(hdrs)
-			_ = w.WriteBody(body)
+		_, err = server.Negotiate(req, []server.Offer{{ContentType: contentTypeHTML}}, w.Header())
+		if err != nil {
+			w.Header().Set(headerContentType, contentTypePlain)
+			w.WriteHeader(response.StatusNotAcceptable)
+			_, _ = w.Write([]byte(response.StatusText(response.StatusNotAcceptable)))
+			return
 		}
-	}
+		w.WriteHeader(status)
+		_, _ = w.Write(body)
+	}).Serve
 
 	srv, err = server.Serve(port, handler)
 	if err != nil {
 		log.Fatalf("Error starting server: %v", err)
 	}
-	defer srv.Close()
 	log.Println("Server started on port", port)
 
 	sigChan = make(chan os.Signal, 1)
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
 	<-sigChan
+	log.Println("Shutting down, waiting for open requests")
+
+	ctx, cancel = context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	err = srv.Shutdown(ctx)
+	if err != nil {
+		log.Printf("Error stopping server: %v", err)
+		return
+	}
 	log.Println("Server gracefully stopped")
 }
@@ -5,6 +5,7 @@ import (
 	"net"
 	"os"
 
+	"github.com/RegistersNinja/httpfromtcp/internal/headers"
 	"github.com/RegistersNinja/httpfromtcp/internal/request"
 )
 
@@ -15,12 +16,12 @@ const (
 
 func main() {
 	var (
-		listener  net.Listener
-		conn      net.Conn
-		r         *request.Request
-		err       error
-		headerKey string
-		headerVal string
+		listener net.Listener
+		conn     net.Conn
+		r        *request.Request
+		err      error
+		field    headers.Field
+		body     []byte
 	)
 
 	listener, err = net.Listen("tcp", localAddr)
@@ -50,12 +51,18 @@ func main() {
 		fmt.Printf("- Version: %s\n", r.RequestLine.HttpVersion)
 
 		fmt.Printf("Headers:\n")
-		for headerKey, headerVal = range r.Headers {
-			fmt.Printf("- %s: ", headerKey)
-			fmt.Printf("%s\n", headerVal)
+		for _, field = range r.Headers.Fields() {
+			fmt.Printf("- %s: ", field.Name)
+			fmt.Printf("%s\n", field.Value)
+		}
+
+		body, err = r.ReadBody()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to read the body: %v\n", err)
+			os.Exit(ExitError)
 		}
 
 		fmt.Printf("Body:\n")
-		fmt.Print(r.Body+"\n")		
+		fmt.Print(string(body) + "\n")
 	}
 }
@@ -0,0 +1,55 @@
+package headers
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	// TimeFormat is the IMF-fixdate layout every HTTP-date is sent in.
+	TimeFormat    string = "Mon, 02 Jan 2006 15:04:05 GMT"
+	rfc850Format  string = "Monday, 02-Jan-06 15:04:05 GMT"
+	asctimeFormat string = "Mon Jan _2 15:04:05 2006"
+)
+
+// ParseHTTPDate parses an HTTP-date (RFC 9110 section 5.6.7). Besides
+// IMF-fixdate it accepts the obsolete RFC 850 and asctime forms, which
+// recipients are still required to understand.
+func ParseHTTPDate(value string) (time.Time, error) {
+	var (
+		layout string
+		t      time.Time
+		err    error
+	)
+
+	for _, layout = range []string{TimeFormat, rfc850Format, asctimeFormat} {
+		t, err = time.Parse(layout, value)
+		if err == nil {
+			return t.UTC(), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("error: invalid HTTP-date %q", value)
+}
+
+// FormatHTTPDate formats t as an IMF-fixdate in GMT.
+func FormatHTTPDate(t time.Time) string {
+	return t.UTC().Format(TimeFormat)
+}
+
+// Date parses the field named key as an HTTP-date, reporting false when it is
+// absent.
+func (h *Headers) Date(key string) (time.Time, bool, error) {
+	var (
+		value string
+		ok    bool
+		t     time.Time
+		err   error
+	)
+
+	value, ok = h.Get(key)
+	if !ok {
+		return time.Time{}, false, nil
+	}
+	t, err = ParseHTTPDate(value)
+	return t, true, err
+}
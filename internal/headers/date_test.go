@@ -0,0 +1,47 @@
+package headers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHTTPDate(t *testing.T) {
+	want := time.Date(1994, time.November, 6, 8, 49, 37, 0, time.UTC)
+	for _, in := range []string{
+		"Sun, 06 Nov 1994 08:49:37 GMT",
+		"Sunday, 06-Nov-94 08:49:37 GMT",
+		"Sun Nov  6 08:49:37 1994",
+	} {
+		got, err := ParseHTTPDate(in)
+		require.NoError(t, err, in)
+		assert.True(t, want.Equal(got), in)
+	}
+
+	for _, in := range []string{"", "yesterday", "Sun, 06 Nov 1994 08:49:37 PST", "2024-01-01T00:00:00Z"} {
+		_, err := ParseHTTPDate(in)
+		assert.Error(t, err, in)
+	}
+
+	t.Run("Round Trip", func(t *testing.T) {
+		local := time.Date(2026, time.October, 18, 23, 5, 0, 0, time.FixedZone("CEST", 2*60*60))
+		formatted := FormatHTTPDate(local)
+		assert.Equal(t, "Sun, 18 Oct 2026 21:05:00 GMT", formatted)
+		parsed, err := ParseHTTPDate(formatted)
+		require.NoError(t, err)
+		assert.True(t, local.Equal(parsed))
+	})
+
+	t.Run("Date Field", func(t *testing.T) {
+		h := NewHeaders()
+		h.Add("If-Modified-Since", "Sun, 06 Nov 1994 08:49:37 GMT")
+		got, ok, err := h.Date("if-modified-since")
+		require.NoError(t, err)
+		assert.True(t, ok)
+		assert.True(t, want.Equal(got))
+		_, ok, _ = h.Date("Last-Modified")
+		assert.False(t, ok)
+	})
+}
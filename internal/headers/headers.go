@@ -2,12 +2,25 @@ package headers
 
 import (
 	"bytes"
-	"fmt"
 	"regexp"
+	"slices"
 	"strings"
+
+	"github.com/RegistersNinja/httpfromtcp/internal/httperror"
 )
 
-type Headers map[string]string
+// Headers keeps every field line in the order it was received or added, with
+// the name as it was written. Lookups are case-insensitive. Repeated fields
+// are stored separately rather than folded with ", ", so values such as
+// Set-Cookie that may contain commas survive intact.
+type Headers struct {
+	fields []Field
+}
+
+type Field struct {
+	Name  string
+	Value string
+}
 
 const (
 	crlf                  string = "\r\n"
@@ -16,30 +29,205 @@ const (
 	tab                   string = "\t"
 	ows                   string = " \t"
 	fieldNameAllowedChars string = `^[A-Za-z0-9!#$%&'*+\-.^_` + "`" + `|~]+$`
+	listJoiner            string = ", "
+	setCookieName         string = "Set-Cookie"
 )
 
 // it's a global variable which is "bad", but it's calculated from constant expression, which is passable
 var validFieldNameRegex = regexp.MustCompile(fieldNameAllowedChars)
 
-func NewHeaders() Headers {
-	return map[string]string{}
+func NewHeaders() *Headers {
+	return &Headers{}
 }
 
 func isValidFieldName(fieldName string) bool {
 	return validFieldNameRegex.MatchString(fieldName)
 }
 
-func (h Headers) Get(key string) (string, bool) {
+// ValidFieldName reports whether name is a token, as RFC 9110 section 5.1
+// requires of field names.
+func ValidFieldName(name string) bool {
+	return isValidFieldName(name)
+}
+
+func isFieldValueCTL(c byte) bool {
+	return (c < ' ' && c != tab[0]) || c == 0x7f
+}
+
+// ValidFieldValue reports whether value can be sent as a field value: no
+// control characters other than HTAB (so no CR or LF) and no leading or
+// trailing whitespace (RFC 9110 section 5.5).
+func ValidFieldValue(value string) bool {
+	var i int
+
+	if value != strings.Trim(value, ows) {
+		return false
+	}
+	for i = 0; i < len(value); i++ {
+		if isFieldValueCTL(value[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// SanitizeFieldValue replaces every control character of value with a space
+// and trims the surrounding whitespace, so the result is a valid field value.
+func SanitizeFieldValue(value string) string {
+	var (
+		sanitized []byte
+		i         int
+	)
+
+	sanitized = []byte(value)
+	for i = range sanitized {
+		if isFieldValueCTL(sanitized[i]) {
+			sanitized[i] = space[0]
+		}
+	}
+	return strings.Trim(string(sanitized), ows)
+}
+
+// Get returns the value of the first field named key.
+func (h *Headers) Get(key string) (string, bool) {
+	var field Field
+
+	for _, field = range h.fields {
+		if strings.EqualFold(field.Name, key) {
+			return field.Value, true
+		}
+	}
+	return "", false
+}
+
+// Values returns the values of every field named key, in order.
+func (h *Headers) Values(key string) []string {
+	var (
+		field  Field
+		values []string
+	)
+
+	for _, field = range h.fields {
+		if strings.EqualFold(field.Name, key) {
+			values = append(values, field.Value)
+		}
+	}
+	return values
+}
+
+// Add appends a field line, keeping any existing fields with the same name.
+func (h *Headers) Add(key string, value string) {
+	h.fields = append(h.fields, Field{Name: key, Value: value})
+}
+
+// Set replaces every field named key with a single one. The field keeps the
+// position of the first one it replaces, or is appended if there was none.
+func (h *Headers) Set(key string, value string) {
 	var (
-		value string
-		ok    bool
+		field    Field
+		kept     []Field
+		replaced bool
 	)
-	value, ok = h[strings.ToLower(key)]
-	return value, ok
+
+	kept = h.fields[:0]
+	for _, field = range h.fields {
+		if !strings.EqualFold(field.Name, key) {
+			kept = append(kept, field)
+			continue
+		}
+		if !replaced {
+			kept = append(kept, Field{Name: key, Value: value})
+			replaced = true
+		}
+	}
+	h.fields = kept
+	if !replaced {
+		h.Add(key, value)
+	}
+}
+
+// Del removes every field named key.
+func (h *Headers) Del(key string) {
+	h.fields = slices.DeleteFunc(h.fields, func(field Field) bool {
+		return strings.EqualFold(field.Name, key)
+	})
+}
+
+// Len returns the number of field lines.
+func (h *Headers) Len() int {
+	return len(h.fields)
+}
+
+// Fields returns a copy of the field lines in order.
+func (h *Headers) Fields() []Field {
+	return slices.Clone(h.fields)
+}
+
+// CanonicalName returns name with the first letter and every letter after a
+// hyphen upper-cased and the rest lower-cased, e.g. "content-type" becomes
+// "Content-Type". Names that are not valid tokens are returned unchanged.
+func CanonicalName(name string) string {
+	var (
+		canonical []byte
+		upper     bool
+		i         int
+		c         byte
+	)
+
+	if !isValidFieldName(name) {
+		return name
+	}
+	canonical = []byte(name)
+	upper = true
+	for i, c = range canonical {
+		switch {
+		case upper && 'a' <= c && c <= 'z':
+			canonical[i] = c - ('a' - 'A')
+		case !upper && 'A' <= c && c <= 'Z':
+			canonical[i] = c + ('a' - 'A')
+		}
+		upper = c == '-'
+	}
+	return string(canonical)
 }
 
-func (h Headers) OverrideHeaderValue(key string, value string) {
-	h[strings.ToLower(key)] = value
+// Combined returns one field per name, at the position of its first
+// occurrence, with the values of repeated fields joined by ", " and exact
+// repeats dropped. Set-Cookie is the exception RFC 9110 section 5.3 makes:
+// its values cannot be combined, so each one stays a separate field.
+func (h *Headers) Combined() []Field {
+	var (
+		combined []Field
+		index    map[string]int
+		seen     map[string][]string
+		field    Field
+		key      string
+		i        int
+		ok       bool
+	)
+
+	index = make(map[string]int)
+	seen = make(map[string][]string)
+	for _, field = range h.fields {
+		key = strings.ToLower(field.Name)
+		if strings.EqualFold(field.Name, setCookieName) {
+			combined = append(combined, field)
+			continue
+		}
+		i, ok = index[key]
+		if !ok {
+			index[key] = len(combined)
+			seen[key] = []string{field.Value}
+			combined = append(combined, field)
+			continue
+		}
+		if slices.Contains(seen[key], field.Value) {
+			continue
+		}
+		seen[key] = append(seen[key], field.Value)
+		combined[i].Value += listJoiner + field.Value
+	}
+	return combined
 }
 
 func parseHeader(header []byte) (key string, value string, err error) {
@@ -48,40 +236,62 @@ func parseHeader(header []byte) (key string, value string, err error) {
 		byteBeforeColon byte
 		namePart        []byte
 		valPart         []byte
+		valueStart      int
+		i               int
 	)
 	colonIndex = bytes.IndexByte(header, colon[0])
 	if colonIndex < 0 {
-		return key, value, fmt.Errorf("error: expected a key:value pair but found %q", string(header))
+		return key, value, httperror.New(httperror.StatusBadRequest, httperror.ReasonInvalidFieldLine, 0,
+			"expected a key:value pair but found %q", string(header))
 	}
 
-	if colonIndex > 0 {
-		if colonIndex == 0 {
-			return key, value, fmt.Errorf("error: field-name must be at least one character long, got: %q", string(header))
+	if header[0] == space[0] || header[0] == tab[0] {
+		// A line starting with whitespace is obs-fold, which an intermediary
+		// may join to the previous field (RFC 9112 section 5.2).
+		return key, value, httperror.New(httperror.StatusBadRequest, httperror.ReasonInvalidFieldLine, 0,
+			"field line must not start with whitespace: %q", string(header))
+	}
 
-		}
-		byteBeforeColon = header[colonIndex-1]
-		if byteBeforeColon == space[0] || byteBeforeColon == tab[0] {
-			return key, value, fmt.Errorf("error: field name must not have whitespace before colon: %q", string(header[:colonIndex]))
-		}
+	if colonIndex == 0 {
+		return key, value, httperror.New(httperror.StatusBadRequest, httperror.ReasonInvalidFieldName, 0,
+			"field-name must be at least one character long, got: %q", string(header))
+	}
+	byteBeforeColon = header[colonIndex-1]
+	if byteBeforeColon == space[0] || byteBeforeColon == tab[0] {
+		return key, value, httperror.New(httperror.StatusBadRequest, httperror.ReasonInvalidFieldName, colonIndex-1,
+			"field name must not have whitespace before colon: %q", string(header[:colonIndex]))
 	}
 
-	namePart = bytes.TrimLeft(header[:colonIndex], ows)
+	namePart = header[:colonIndex]
 	if !isValidFieldName(string(namePart)) {
-		return key, value, fmt.Errorf("error: invalid field-name %q", string(namePart))
+		return key, value, httperror.New(httperror.StatusBadRequest, httperror.ReasonInvalidFieldName, colonIndex-len(namePart),
+			"invalid field-name %q", string(namePart))
 	}
 
-	valPart = bytes.TrimSpace(header[colonIndex+1:])
+	valPart = bytes.TrimLeft(header[colonIndex+1:], ows)
+	valueStart = len(header) - len(valPart)
+	valPart = bytes.TrimRight(valPart, ows)
+	for i = range valPart {
+		if isFieldValueCTL(valPart[i]) {
+			// A bare CR or a NUL is read differently by different parsers
+			// (RFC 9112 section 2.2, RFC 9110 section 5.5).
+			return key, value, httperror.New(httperror.StatusBadRequest, httperror.ReasonInvalidFieldValue, valueStart+i,
+				"invalid character %q in value of %q", valPart[i], string(namePart))
+		}
+	}
 
-	return strings.ToLower(string(namePart)), string(valPart), nil
+	return string(namePart), string(valPart), nil
 }
 
-func (h Headers) Parse(data []byte) (bytesConsumed int, done bool, err error) {
+// Parse consumes one field line from data, or the empty line ending the field
+// section, in which case done is true. Errors are *httperror.ParseError with
+// Offset counted from the start of data.
+func (h *Headers) Parse(data []byte) (bytesConsumed int, done bool, err error) {
 	var (
-		crlfSplit        [][]byte
-		header           []byte
-		fieldName        string
-		fieldValue       string
-		isFieldNameInMap bool
+		crlfSplit  [][]byte
+		header     []byte
+		fieldName  string
+		fieldValue string
 	)
 
 	crlfSplit = bytes.SplitN(data, []byte(crlf), 2)
@@ -101,12 +311,7 @@ func (h Headers) Parse(data []byte) (bytesConsumed int, done bool, err error) {
 		return bytesConsumed, done, err
 	}
 
-	_, isFieldNameInMap = h[fieldName]
-	if isFieldNameInMap {
-		h[fieldName] += (", " + fieldValue)
-	} else {
-		h[fieldName] = fieldValue
-	}
+	h.Add(fieldName, fieldValue)
 
 	bytesConsumed = len(header) + len(crlf)
 	return bytesConsumed, done, nil
@@ -7,6 +7,11 @@ import (
 	"github.com/stretchr/testify/require"
 )
 
+func get(h *Headers, key string) string {
+	value, _ := h.Get(key)
+	return value
+}
+
 func TestParseHeaders(t *testing.T) {
 	// Test: Valid single header
 	headers := NewHeaders()
@@ -14,7 +19,7 @@ func TestParseHeaders(t *testing.T) {
 	n, done, err := headers.Parse(data)
 	require.NoError(t, err)
 	require.NotNil(t, headers)
-	assert.Equal(t, "localhost:42069", headers["host"]) // Map key is lowercase
+	assert.Equal(t, "localhost:42069", get(headers, "host"))
 	assert.Equal(t, 23, n)
 	assert.False(t, done)
 
@@ -28,24 +33,32 @@ func TestParseHeaders(t *testing.T) {
 
 	// Test: Valid single header with extra whitespace
 	headers = NewHeaders()
-	data = []byte("          Host: localhost:42069    \r\n\r\n")
+	data = []byte("Host:    localhost:42069    \r\n\r\n")
 	n, done, err = headers.Parse(data)
 	require.NoError(t, err)
 	require.NotNil(t, headers)
-	assert.Equal(t, "localhost:42069", headers["host"]) // Map key is lowercase
-	assert.Equal(t, 37, n)
+	assert.Equal(t, "localhost:42069", get(headers, "host"))
+	assert.Equal(t, 30, n)
+	assert.False(t, done)
+
+	// Test: Field line starting with whitespace (obs-fold)
+	headers = NewHeaders()
+	data = []byte("          Host: localhost:42069    \r\n\r\n")
+	n, done, err = headers.Parse(data)
+	require.Error(t, err)
+	assert.Equal(t, 0, n)
 	assert.False(t, done)
 
 	// Test: Valid 2 headers with existing headers
 	headers = NewHeaders()
-	headers["foo"] = "bar" // Existing header key is lowercase
+	headers.Add("foo", "bar")
 	data = []byte("Host: localhost:42069\r\nUser-Agent: tiny\r\n\r\n")
 
 	// first header
 	n, done, err = headers.Parse(data)
 	require.NoError(t, err)
 	assert.False(t, done)
-	assert.Equal(t, "localhost:42069", headers["host"]) // Map key is lowercase
+	assert.Equal(t, "localhost:42069", get(headers, "host"))
 	assert.Equal(t, 23, n)                              // "Host: localhost:42069\r\n"
 
 	// second header
@@ -53,11 +66,11 @@ func TestParseHeaders(t *testing.T) {
 	n, done, err = headers.Parse(data)
 	require.NoError(t, err)
 	assert.False(t, done)
-	assert.Equal(t, "tiny", headers["user-agent"]) // Map key is lowercase
+	assert.Equal(t, "tiny", get(headers, "user-agent"))
 	assert.Equal(t, 18, n)                         // "User-Agent: tiny\r\n"
 
 	// existing header preserved
-	assert.Equal(t, "bar", headers["foo"]) // Existing header key is lowercase
+	assert.Equal(t, "bar", get(headers, "foo"))
 
 	// Test: Valid done
 	headers = NewHeaders()
@@ -81,7 +94,7 @@ func TestParseHeaders(t *testing.T) {
 	n, done, err = headers.Parse(data)
 	require.NoError(t, err)
 	require.NotNil(t, headers)
-	assert.Equal(t, "value", headers["x-custom-header"]) // Map key is lowercase
+	assert.Equal(t, "value", get(headers, "x-custom-header"))
 	assert.Equal(t, 24, n)
 	assert.False(t, done)
 
@@ -95,14 +108,14 @@ func TestParseHeaders(t *testing.T) {
 
 	// Test: Multiple values for the same header key
     headers = NewHeaders()
-    headers["set-person"] = "lane-loves-go" // Existing header key is lowercase
+    headers.Add("set-person", "lane-loves-go")
     data = []byte("Set-Person: prime-loves-zig\r\nSet-Person: tj-loves-ocaml\r\n\r\n")
 
     // Parse first header
     n, done, err = headers.Parse(data)
     require.NoError(t, err)
     assert.False(t, done)
-    assert.Equal(t, "lane-loves-go, prime-loves-zig", headers["set-person"])
+    assert.Equal(t, []string{"lane-loves-go", "prime-loves-zig"}, headers.Values("set-person"))
     assert.Equal(t, 29, n) // "Set-Person: prime-loves-zig\r\n"
 
     // Parse second header
@@ -110,6 +123,93 @@ func TestParseHeaders(t *testing.T) {
     n, done, err = headers.Parse(data)
     require.NoError(t, err)
     assert.False(t, done)
-    assert.Equal(t, "lane-loves-go, prime-loves-zig, tj-loves-ocaml", headers["set-person"])
+    assert.Equal(t, []string{"lane-loves-go", "prime-loves-zig", "tj-loves-ocaml"}, headers.Values("set-person"))
     assert.Equal(t, 28, n) // "Set-Person: tj-loves-ocaml\r\n"
 }
+
+func TestHeadersMultiValue(t *testing.T) {
+	t.Run("Order And Casing Preserved", func(t *testing.T) {
+		headers := NewHeaders()
+		data := []byte("X-Trace: a\r\nHost: example.com\r\nx-trace: b\r\n\r\n")
+		total := 0
+		for {
+			n, done, err := headers.Parse(data[total:])
+			require.NoError(t, err)
+			total += n
+			if done {
+				break
+			}
+		}
+		assert.Equal(t, []Field{
+			{Name: "X-Trace", Value: "a"},
+			{Name: "Host", Value: "example.com"},
+			{Name: "x-trace", Value: "b"},
+		}, headers.Fields())
+		assert.Equal(t, []string{"a", "b"}, headers.Values("X-TRACE"))
+		assert.Equal(t, "a", get(headers, "x-trace"))
+	})
+
+	t.Run("Values With Commas Stay Separate", func(t *testing.T) {
+		headers := NewHeaders()
+		headers.Add("Set-Cookie", "a=1; Expires=Wed, 21 Oct 2026 07:28:00 GMT")
+		headers.Add("Set-Cookie", "b=2")
+		assert.Equal(t, []string{"a=1; Expires=Wed, 21 Oct 2026 07:28:00 GMT", "b=2"}, headers.Values("set-cookie"))
+		assert.Equal(t, 2, headers.Len())
+	})
+
+	t.Run("Set Replaces In Place", func(t *testing.T) {
+		headers := NewHeaders()
+		headers.Add("A", "1")
+		headers.Add("B", "2")
+		headers.Add("a", "3")
+		headers.Set("A", "4")
+		assert.Equal(t, []Field{{Name: "A", Value: "4"}, {Name: "B", Value: "2"}}, headers.Fields())
+
+		headers.Set("C", "5")
+		assert.Equal(t, []Field{{Name: "A", Value: "4"}, {Name: "B", Value: "2"}, {Name: "C", Value: "5"}}, headers.Fields())
+	})
+
+	t.Run("Del Removes All", func(t *testing.T) {
+		headers := NewHeaders()
+		headers.Add("A", "1")
+		headers.Add("B", "2")
+		headers.Add("a", "3")
+		headers.Del("a")
+		assert.Equal(t, []Field{{Name: "B", Value: "2"}}, headers.Fields())
+		_, ok := headers.Get("A")
+		assert.False(t, ok)
+		assert.Nil(t, headers.Values("A"))
+	})
+}
+
+func TestCanonicalName(t *testing.T) {
+	tests := map[string]string{
+		"content-type":   "Content-Type",
+		"CONTENT-LENGTH": "Content-Length",
+		"x-request-id":   "X-Request-Id",
+		"host":           "Host",
+		"-weird--name-":  "-Weird--Name-",
+		"bad name":       "bad name",
+		"x_under_score":  "X_under_score",
+	}
+	for in, want := range tests {
+		assert.Equal(t, want, CanonicalName(in), in)
+	}
+}
+
+func TestHeadersCombined(t *testing.T) {
+	headers := NewHeaders()
+	headers.Add("Vary", "Accept")
+	headers.Add("Set-Cookie", "a=1")
+	headers.Add("content-length", "5")
+	headers.Add("Content-Length", "5")
+	headers.Add("vary", "Accept-Encoding")
+	headers.Add("Set-Cookie", "b=2")
+	headers.Add("VARY", "Accept")
+	assert.Equal(t, []Field{
+		{Name: "Vary", Value: "Accept, Accept-Encoding"},
+		{Name: "Set-Cookie", Value: "a=1"},
+		{Name: "content-length", Value: "5"},
+		{Name: "Set-Cookie", Value: "b=2"},
+	}, headers.Combined())
+}
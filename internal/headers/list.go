@@ -0,0 +1,268 @@
+package headers
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+const (
+	listSeparator  byte    = ','
+	paramSeparator byte    = ';'
+	paramAssign    byte    = '='
+	quote          byte    = '"'
+	backslash      byte    = '\\'
+	qualityParam   string  = "q"
+	maxQuality     float64 = 1
+)
+
+// Param is a name=value parameter of a list element or media type. Names are
+// lower-cased; values are unquoted.
+type Param struct {
+	Name  string
+	Value string
+}
+
+// QualityValue is one element of an Accept-style list with its weight.
+type QualityValue struct {
+	Value  string
+	Params []Param
+	Q      float64
+}
+
+// splitQuoted splits s at every sep outside a quoted-string, trims the
+// surrounding whitespace of each part and drops empty ones.
+func splitQuoted(s string, sep byte) []string {
+	var (
+		parts    []string
+		part     string
+		start    int
+		i        int
+		inQuotes bool
+	)
+
+	for i = 0; i < len(s); i++ {
+		switch {
+		case inQuotes && s[i] == backslash:
+			i++
+		case s[i] == quote:
+			inQuotes = !inQuotes
+		case !inQuotes && s[i] == sep:
+			part = strings.Trim(s[start:i], ows)
+			if part != "" {
+				parts = append(parts, part)
+			}
+			start = i + 1
+		}
+	}
+	part = strings.Trim(s[start:], ows)
+	if part != "" {
+		parts = append(parts, part)
+	}
+	return parts
+}
+
+// SplitList splits a comma-separated list field value into its elements
+// (RFC 9110 section 5.6.1). Commas inside quoted strings do not split, and
+// empty elements are dropped.
+func SplitList(value string) []string {
+	return splitQuoted(value, listSeparator)
+}
+
+// List returns the elements of every field named key, in order.
+func (h *Headers) List(key string) []string {
+	var (
+		value    string
+		elements []string
+	)
+
+	for _, value = range h.Values(key) {
+		elements = append(elements, SplitList(value)...)
+	}
+	return elements
+}
+
+// Unquote returns the content of a quoted-string with its escapes removed, or
+// s unchanged if it is not quoted.
+func Unquote(s string) (string, error) {
+	var (
+		unquoted []byte
+		i        int
+	)
+
+	if len(s) < 2 || s[0] != quote || s[len(s)-1] != quote {
+		if strings.IndexByte(s, quote) >= 0 {
+			return "", fmt.Errorf("error: unterminated quoted-string %q", s)
+		}
+		return s, nil
+	}
+	for i = 1; i < len(s)-1; i++ {
+		switch s[i] {
+		case backslash:
+			i++
+			if i == len(s)-1 {
+				return "", fmt.Errorf("error: dangling escape in %q", s)
+			}
+		case quote:
+			return "", fmt.Errorf("error: unescaped quote in %q", s)
+		}
+		unquoted = append(unquoted, s[i])
+	}
+	return string(unquoted), nil
+}
+
+// Quote returns s as is when it is a token, and as a quoted-string otherwise.
+func Quote(s string) string {
+	var (
+		quoted []byte
+		i      int
+	)
+
+	if isValidFieldName(s) {
+		return s
+	}
+	quoted = append(quoted, quote)
+	for i = 0; i < len(s); i++ {
+		if s[i] == quote || s[i] == backslash {
+			quoted = append(quoted, backslash)
+		}
+		quoted = append(quoted, s[i])
+	}
+	return string(append(quoted, quote))
+}
+
+// parseParams parses the ";"-separated parameters following a list element or
+// media type.
+func parseParams(parts []string) ([]Param, error) {
+	var (
+		params []Param
+		part   string
+		name   string
+		value  string
+		found  bool
+		err    error
+	)
+
+	for _, part = range parts {
+		name, value, found = strings.Cut(part, string(paramAssign))
+		name = strings.Trim(name, ows)
+		if !found || !isValidFieldName(name) {
+			return nil, fmt.Errorf("error: invalid parameter %q", part)
+		}
+		value, err = Unquote(strings.Trim(value, ows))
+		if err != nil {
+			return nil, err
+		}
+		params = append(params, Param{Name: strings.ToLower(name), Value: value})
+	}
+	return params, nil
+}
+
+func formatParams(params []Param) string {
+	var (
+		b     strings.Builder
+		param Param
+	)
+
+	for _, param = range params {
+		b.WriteByte(paramSeparator)
+		b.WriteString(param.Name)
+		b.WriteByte(paramAssign)
+		b.WriteString(Quote(param.Value))
+	}
+	return b.String()
+}
+
+// parseQuality parses a weight as RFC 9110 section 12.4.2 defines it: 0 or 1
+// with at most three decimals.
+func parseQuality(s string) (float64, error) {
+	var (
+		q        float64
+		integer  string
+		fraction string
+		found    bool
+		err      error
+	)
+
+	integer, fraction, found = strings.Cut(s, ".")
+	if (integer != "0" && integer != "1") || len(fraction) > 3 || (found && strings.Trim(fraction, "0123456789") != "") {
+		return 0, fmt.Errorf("error: invalid quality value %q", s)
+	}
+	q, err = strconv.ParseFloat(s, 64)
+	if err != nil || q > maxQuality {
+		return 0, fmt.Errorf("error: invalid quality value %q", s)
+	}
+	return q, nil
+}
+
+// ParseQualityList parses an Accept-style field value into its elements
+// ordered by preference: highest weight first, ties kept in the order they
+// were listed. Elements without "q" weigh 1; parameters after "q" are
+// dropped.
+func ParseQualityList(value string) ([]QualityValue, error) {
+	var (
+		list    []QualityValue
+		element string
+		rest    string
+		params  []Param
+		param   Param
+		qv      QualityValue
+		i       int
+		err     error
+	)
+
+	for _, element = range SplitList(value) {
+		element, rest, _ = strings.Cut(element, string(paramSeparator))
+		element = strings.Trim(element, ows)
+		if element == "" {
+			return nil, fmt.Errorf("error: list element without a value")
+		}
+		params, err = parseParams(splitQuoted(rest, paramSeparator))
+		if err != nil {
+			return nil, err
+		}
+		qv = QualityValue{Value: element, Q: maxQuality}
+		for i, param = range params {
+			if param.Name == qualityParam {
+				qv.Q, err = parseQuality(param.Value)
+				if err != nil {
+					return nil, err
+				}
+				params = params[:i]
+				break
+			}
+		}
+		qv.Params = params
+		list = append(list, qv)
+	}
+	slices.SortStableFunc(list, func(a QualityValue, b QualityValue) int {
+		switch {
+		case a.Q > b.Q:
+			return -1
+		case a.Q < b.Q:
+			return 1
+		}
+		return 0
+	})
+	return list, nil
+}
+
+// FormatQualityList is the inverse of ParseQualityList; weights of 1 are left
+// out.
+func FormatQualityList(list []QualityValue) string {
+	var (
+		elements []string
+		qv       QualityValue
+		element  string
+	)
+
+	for _, qv = range list {
+		element = qv.Value + formatParams(qv.Params)
+		if qv.Q != maxQuality {
+			element += string(paramSeparator) + qualityParam + "=" + strconv.FormatFloat(qv.Q, 'f', -1, 64)
+		}
+		elements = append(elements, element)
+	}
+	return strings.Join(elements, ", ")
+}
@@ -0,0 +1,72 @@
+package headers
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSplitList(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []string
+	}{
+		{"gzip, deflate", []string{"gzip", "deflate"}},
+		{" a ,, b ,", []string{"a", "b"}},
+		{`foo; note="a, b", bar`, []string{`foo; note="a, b"`, "bar"}},
+		{`"x\", y", z`, []string{`"x\", y"`, "z"}},
+		{"", nil},
+	}
+	for _, tc := range tests {
+		assert.Equal(t, tc.want, SplitList(tc.in), tc.in)
+	}
+
+	h := NewHeaders()
+	h.Add("Cache-Control", "no-cache, max-age=0")
+	h.Add("cache-control", "private")
+	assert.Equal(t, []string{"no-cache", "max-age=0", "private"}, h.List("Cache-Control"))
+}
+
+func TestQuote(t *testing.T) {
+	for _, s := range []string{"token", "two words", `say "hi"`, `back\slash`, ""} {
+		unquoted, err := Unquote(Quote(s))
+		require.NoError(t, err)
+		assert.Equal(t, s, unquoted)
+	}
+	assert.Equal(t, "token", Quote("token"))
+	assert.Equal(t, `"a b"`, Quote("a b"))
+
+	for _, s := range []string{`"open`, `"a"b"`, `"a\"`} {
+		_, err := Unquote(s)
+		assert.Error(t, err, s)
+	}
+}
+
+func TestParseQualityList(t *testing.T) {
+	list, err := ParseQualityList("text/html;level=1;q=0.5, application/json, */*;q=0.1, text/plain;q=0.5;ext=1")
+	require.NoError(t, err)
+	assert.Equal(t, []QualityValue{
+		{Value: "application/json", Q: 1},
+		{Value: "text/html", Params: []Param{{Name: "level", Value: "1"}}, Q: 0.5},
+		{Value: "text/plain", Params: []Param{}, Q: 0.5},
+		{Value: "*/*", Params: []Param{}, Q: 0.1},
+	}, list)
+
+	for _, in := range []string{"gzip;q=2", "gzip;q=0.1234", "gzip;q=abc", "gzip;q=-0", ";q=1", "gzip;noequals"} {
+		_, err = ParseQualityList(in)
+		assert.Error(t, err, in)
+	}
+
+	t.Run("Round Trip", func(t *testing.T) {
+		for _, in := range []string{
+			"gzip, br;q=0.8, identity;q=0",
+			`text/html;charset="utf 8";q=0.001`,
+			"en-US, en;q=0.9, *;q=0.5",
+		} {
+			list, err := ParseQualityList(in)
+			require.NoError(t, err)
+			assert.Equal(t, in, FormatQualityList(list))
+		}
+	})
+}
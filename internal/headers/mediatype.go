@@ -0,0 +1,96 @@
+package headers
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	contentTypeName   string = "Content-Type"
+	mediaTypeSlash    string = "/"
+	mediaTypeWildcard string = "*"
+)
+
+// MediaType is a parsed media-type (RFC 9110 section 8.3.1). Type and Subtype
+// are lower-cased, as the comparison is case-insensitive.
+type MediaType struct {
+	Type    string
+	Subtype string
+	Params  []Param
+}
+
+// ParseMediaType parses a value such as `text/html; charset="utf-8"`.
+func ParseMediaType(value string) (MediaType, error) {
+	var (
+		mt        MediaType
+		essence   string
+		rest      string
+		mediaType string
+		subtype   string
+		found     bool
+		err       error
+	)
+
+	essence, rest, _ = strings.Cut(value, string(paramSeparator))
+	mediaType, subtype, found = strings.Cut(strings.Trim(essence, ows), mediaTypeSlash)
+	if !found || !isValidFieldName(mediaType) || !isValidFieldName(subtype) {
+		return MediaType{}, fmt.Errorf("error: invalid media type %q", value)
+	}
+	mt.Type = strings.ToLower(mediaType)
+	mt.Subtype = strings.ToLower(subtype)
+	mt.Params, err = parseParams(splitQuoted(rest, paramSeparator))
+	if err != nil {
+		return MediaType{}, err
+	}
+	return mt, nil
+}
+
+// Essence returns "type/subtype" without parameters.
+func (mt MediaType) Essence() string {
+	return mt.Type + mediaTypeSlash + mt.Subtype
+}
+
+// Param returns the value of the parameter called name.
+func (mt MediaType) Param(name string) (string, bool) {
+	var param Param
+
+	for _, param = range mt.Params {
+		if strings.EqualFold(param.Name, name) {
+			return param.Value, true
+		}
+	}
+	return "", false
+}
+
+// Matches reports whether mt is covered by pattern, which may use "*" for the
+// type or subtype as in Accept. Parameters are not compared.
+func (mt MediaType) Matches(pattern MediaType) bool {
+	if pattern.Type != mediaTypeWildcard && pattern.Type != mt.Type {
+		return false
+	}
+	return pattern.Subtype == mediaTypeWildcard || pattern.Subtype == mt.Subtype
+}
+
+// String formats mt for use as a field value, quoting parameter values that
+// are not tokens.
+func (mt MediaType) String() string {
+	return mt.Essence() + formatParams(mt.Params)
+}
+
+// ContentType parses the Content-Type field, reporting false when it is
+// absent.
+func (h *Headers) ContentType() (MediaType, bool, error) {
+	var (
+		value string
+		ok    bool
+		mt    MediaType
+		err   error
+	)
+
+	value, ok = h.Get(contentTypeName)
+	if !ok {
+		return MediaType{}, false, nil
+	}
+	mt, err = ParseMediaType(value)
+	return mt, true, err
+}
@@ -0,0 +1,59 @@
+package headers
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseMediaType(t *testing.T) {
+	mt, err := ParseMediaType(`Text/HTML; Charset="utf-8"; note="a; b"`)
+	require.NoError(t, err)
+	assert.Equal(t, "text", mt.Type)
+	assert.Equal(t, "html", mt.Subtype)
+	assert.Equal(t, "text/html", mt.Essence())
+	charset, ok := mt.Param("charset")
+	assert.True(t, ok)
+	assert.Equal(t, "utf-8", charset)
+	note, _ := mt.Param("note")
+	assert.Equal(t, "a; b", note)
+
+	for _, in := range []string{"", "text", "text/", "/html", "te xt/html", "text/html; charset", `text/html; a="b`} {
+		_, err = ParseMediaType(in)
+		assert.Error(t, err, in)
+	}
+
+	t.Run("Round Trip", func(t *testing.T) {
+		for _, in := range []string{
+			"text/plain",
+			"text/html;charset=utf-8",
+			`multipart/form-data;boundary="a b c"`,
+		} {
+			mt, err := ParseMediaType(in)
+			require.NoError(t, err)
+			assert.Equal(t, in, mt.String())
+		}
+	})
+
+	t.Run("Matches", func(t *testing.T) {
+		mt, _ := ParseMediaType("text/html")
+		for pattern, want := range map[string]bool{"*/*": true, "text/*": true, "text/html": true, "text/plain": false, "image/*": false} {
+			p, err := ParseMediaType(pattern)
+			require.NoError(t, err)
+			assert.Equal(t, want, mt.Matches(p), pattern)
+		}
+	})
+
+	t.Run("Content-Type Field", func(t *testing.T) {
+		h := NewHeaders()
+		_, ok, err := h.ContentType()
+		assert.False(t, ok)
+		assert.NoError(t, err)
+		h.Add("content-type", "application/json")
+		mt, ok, err := h.ContentType()
+		require.NoError(t, err)
+		assert.True(t, ok)
+		assert.Equal(t, "application/json", mt.Essence())
+	})
+}
@@ -0,0 +1,461 @@
+package sfv
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	maxIntegerDigits  int = 15
+	maxDecimalDigits  int = 16
+	maxIntegerPartLen int = 12
+	maxFractionLen    int = 3
+)
+
+// parser walks the field value with the algorithms of RFC 8941 section 4.2.
+type parser struct {
+	s   string
+	pos int
+}
+
+func (p *parser) eof() bool {
+	return p.pos >= len(p.s)
+}
+
+func (p *parser) peek() byte {
+	if p.eof() {
+		return 0
+	}
+	return p.s[p.pos]
+}
+
+func (p *parser) discardSP() {
+	for !p.eof() && p.s[p.pos] == ' ' {
+		p.pos++
+	}
+}
+
+func (p *parser) discardOWS() {
+	for !p.eof() && (p.s[p.pos] == ' ' || p.s[p.pos] == '\t') {
+		p.pos++
+	}
+}
+
+func (p *parser) fail(format string, args ...any) error {
+	return fmt.Errorf("error: structured field at offset %d: "+format, append([]any{p.pos}, args...)...)
+}
+
+// finish checks that only trailing spaces are left once the top-level value
+// has been parsed.
+func (p *parser) finish() error {
+	p.discardSP()
+	if !p.eof() {
+		return p.fail("unexpected %q", p.peek())
+	}
+	return nil
+}
+
+// ParseItem parses a field whose value is a single Item.
+func ParseItem(value string) (Item, error) {
+	var (
+		p    *parser
+		item Item
+		err  error
+	)
+
+	p = &parser{s: value}
+	p.discardSP()
+	item, err = p.parseItem()
+	if err != nil {
+		return Item{}, err
+	}
+	return item, p.finish()
+}
+
+// ParseList parses a field whose value is a List. An empty value is an empty
+// List.
+func ParseList(value string) (List, error) {
+	var (
+		p    *parser
+		list List
+		err  error
+	)
+
+	p = &parser{s: value}
+	p.discardSP()
+	list, err = p.parseList()
+	if err != nil {
+		return nil, err
+	}
+	return list, p.finish()
+}
+
+// ParseDictionary parses a field whose value is a Dictionary. An empty value
+// is an empty Dictionary.
+func ParseDictionary(value string) (Dictionary, error) {
+	var (
+		p    *parser
+		dict Dictionary
+		err  error
+	)
+
+	p = &parser{s: value}
+	p.discardSP()
+	dict, err = p.parseDictionary()
+	if err != nil {
+		return nil, err
+	}
+	return dict, p.finish()
+}
+
+// afterMember consumes the separator after a List or Dictionary member and
+// reports whether another member follows.
+func (p *parser) afterMember() (bool, error) {
+	p.discardOWS()
+	if p.eof() {
+		return false, nil
+	}
+	if p.peek() != ',' {
+		return false, p.fail("expected ',' but found %q", p.peek())
+	}
+	p.pos++
+	p.discardOWS()
+	if p.eof() {
+		return false, p.fail("trailing comma")
+	}
+	return true, nil
+}
+
+func (p *parser) parseList() (List, error) {
+	var (
+		list   List
+		member Member
+		more   bool
+		err    error
+	)
+
+	list = List{}
+	for !p.eof() {
+		member, err = p.parseItemOrInnerList()
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, member)
+		more, err = p.afterMember()
+		if err != nil || !more {
+			return list, err
+		}
+	}
+	return list, nil
+}
+
+func (p *parser) parseDictionary() (Dictionary, error) {
+	var (
+		dict   Dictionary
+		key    string
+		member Member
+		params Params
+		more   bool
+		err    error
+	)
+
+	dict = Dictionary{}
+	for !p.eof() {
+		key, err = p.parseKey()
+		if err != nil {
+			return nil, err
+		}
+		if p.peek() == '=' {
+			p.pos++
+			member, err = p.parseItemOrInnerList()
+		} else {
+			params, err = p.parseParameters()
+			member = Item{Value: true, Params: params}
+		}
+		if err != nil {
+			return nil, err
+		}
+		dict = dict.set(key, member)
+		more, err = p.afterMember()
+		if err != nil || !more {
+			return dict, err
+		}
+	}
+	return dict, nil
+}
+
+func (p *parser) parseItemOrInnerList() (Member, error) {
+	if p.peek() == '(' {
+		return p.parseInnerList()
+	}
+	return p.parseItem()
+}
+
+func (p *parser) parseInnerList() (InnerList, error) {
+	var (
+		list InnerList
+		item Item
+		err  error
+	)
+
+	p.pos++
+	list.Items = []Item{}
+	for !p.eof() {
+		p.discardSP()
+		if p.peek() == ')' {
+			p.pos++
+			list.Params, err = p.parseParameters()
+			return list, err
+		}
+		item, err = p.parseItem()
+		if err != nil {
+			return InnerList{}, err
+		}
+		list.Items = append(list.Items, item)
+		if p.peek() != ' ' && p.peek() != ')' {
+			return InnerList{}, p.fail("expected ' ' or ')' in inner list")
+		}
+	}
+	return InnerList{}, p.fail("unterminated inner list")
+}
+
+func (p *parser) parseItem() (Item, error) {
+	var (
+		item Item
+		err  error
+	)
+
+	item.Value, err = p.parseBareItem()
+	if err != nil {
+		return Item{}, err
+	}
+	item.Params, err = p.parseParameters()
+	if err != nil {
+		return Item{}, err
+	}
+	return item, nil
+}
+
+func (p *parser) parseParameters() (Params, error) {
+	var (
+		params Params
+		key    string
+		value  BareItem
+		err    error
+	)
+
+	params = Params{}
+	for p.peek() == ';' {
+		p.pos++
+		p.discardSP()
+		key, err = p.parseKey()
+		if err != nil {
+			return nil, err
+		}
+		value = true
+		if p.peek() == '=' {
+			p.pos++
+			value, err = p.parseBareItem()
+			if err != nil {
+				return nil, err
+			}
+		}
+		params = params.set(key, value)
+	}
+	return params, nil
+}
+
+func isLCAlpha(c byte) bool {
+	return 'a' <= c && c <= 'z'
+}
+
+func isAlpha(c byte) bool {
+	return isLCAlpha(c) || ('A' <= c && c <= 'Z')
+}
+
+func isDigit(c byte) bool {
+	return '0' <= c && c <= '9'
+}
+
+func isKeyChar(c byte) bool {
+	return isLCAlpha(c) || isDigit(c) || c == '_' || c == '-' || c == '.' || c == '*'
+}
+
+// isTokenChar reports whether c may follow the first character of a token:
+// a tchar, ':' or '/'.
+func isTokenChar(c byte) bool {
+	return isAlpha(c) || isDigit(c) || strings.IndexByte("!#$%&'*+-.^_`|~:/", c) >= 0
+}
+
+func (p *parser) parseKey() (string, error) {
+	var start int
+
+	if !isLCAlpha(p.peek()) && p.peek() != '*' {
+		return "", p.fail("invalid key")
+	}
+	start = p.pos
+	for !p.eof() && isKeyChar(p.peek()) {
+		p.pos++
+	}
+	return p.s[start:p.pos], nil
+}
+
+func (p *parser) parseBareItem() (BareItem, error) {
+	var c byte
+
+	c = p.peek()
+	switch {
+	case c == '-' || isDigit(c):
+		return p.parseNumber()
+	case c == '"':
+		return p.parseString()
+	case c == '*' || isAlpha(c):
+		return p.parseToken(), nil
+	case c == ':':
+		return p.parseByteSequence()
+	case c == '?':
+		return p.parseBoolean()
+	}
+	return nil, p.fail("unexpected %q at start of item", c)
+}
+
+func (p *parser) parseNumber() (BareItem, error) {
+	var (
+		start       int
+		digitsStart int
+		isDecimal   bool
+		integer     int64
+		decimal     float64
+		text        string
+		dot         int
+		err         error
+	)
+
+	start = p.pos
+	if p.peek() == '-' {
+		p.pos++
+	}
+	digitsStart = p.pos
+	if !isDigit(p.peek()) {
+		return nil, p.fail("expected a digit")
+	}
+	for !p.eof() {
+		if p.peek() == '.' && !isDecimal {
+			if p.pos-digitsStart > maxIntegerPartLen {
+				return nil, p.fail("integer part of decimal is too long")
+			}
+			isDecimal = true
+		} else if !isDigit(p.peek()) {
+			break
+		}
+		p.pos++
+		if !isDecimal && p.pos-digitsStart > maxIntegerDigits {
+			return nil, p.fail("integer is too long")
+		}
+		if isDecimal && p.pos-digitsStart > maxDecimalDigits {
+			return nil, p.fail("decimal is too long")
+		}
+	}
+
+	text = p.s[start:p.pos]
+	if !isDecimal {
+		integer, err = strconv.ParseInt(text, 10, 64)
+		if err != nil {
+			return nil, p.fail("invalid integer %q", text)
+		}
+		return integer, nil
+	}
+	dot = strings.IndexByte(text, '.')
+	if dot == len(text)-1 || len(text)-dot-1 > maxFractionLen {
+		return nil, p.fail("decimal needs one to three fractional digits, got %q", text)
+	}
+	decimal, err = strconv.ParseFloat(text, 64)
+	if err != nil {
+		return nil, p.fail("invalid decimal %q", text)
+	}
+	return decimal, nil
+}
+
+func (p *parser) parseString() (string, error) {
+	var (
+		b strings.Builder
+		c byte
+	)
+
+	p.pos++
+	for !p.eof() {
+		c = p.s[p.pos]
+		p.pos++
+		switch {
+		case c == '\\':
+			if p.eof() || (p.peek() != '"' && p.peek() != '\\') {
+				return "", p.fail("invalid escape in string")
+			}
+			b.WriteByte(p.s[p.pos])
+			p.pos++
+		case c == '"':
+			return b.String(), nil
+		case c < 0x20 || c > 0x7e:
+			return "", p.fail("invalid character %q in string", c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return "", p.fail("unterminated string")
+}
+
+func (p *parser) parseToken() Token {
+	var start int
+
+	start = p.pos
+	p.pos++
+	for !p.eof() && isTokenChar(p.peek()) {
+		p.pos++
+	}
+	return Token(p.s[start:p.pos])
+}
+
+func isBase64Char(c byte) bool {
+	return isAlpha(c) || isDigit(c) || c == '+' || c == '/' || c == '='
+}
+
+func (p *parser) parseByteSequence() ([]byte, error) {
+	var (
+		start   int
+		decoded []byte
+		err     error
+	)
+
+	p.pos++
+	start = p.pos
+	for !p.eof() && p.peek() != ':' {
+		if !isBase64Char(p.peek()) {
+			return nil, p.fail("invalid character %q in byte sequence", p.peek())
+		}
+		p.pos++
+	}
+	if p.eof() {
+		return nil, p.fail("unterminated byte sequence")
+	}
+	decoded, err = base64.StdEncoding.DecodeString(p.s[start:p.pos])
+	if err != nil {
+		return nil, p.fail("invalid base64 in byte sequence")
+	}
+	p.pos++
+	return decoded, nil
+}
+
+func (p *parser) parseBoolean() (bool, error) {
+	p.pos++
+	switch p.peek() {
+	case '1':
+		p.pos++
+		return true, nil
+	case '0':
+		p.pos++
+		return false, nil
+	}
+	return false, p.fail("boolean must be ?0 or ?1")
+}
@@ -0,0 +1,251 @@
+package sfv
+
+import (
+	"encoding/base64"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+const (
+	maxInteger   int64   = 999_999_999_999_999
+	decimalLimit float64 = 1e12
+	decimalScale float64 = 1000
+)
+
+// SerializeItem returns the field value for item, following RFC 8941
+// section 4.1.
+func SerializeItem(item Item) (string, error) {
+	var (
+		b   strings.Builder
+		err error
+	)
+
+	err = writeItem(&b, item)
+	if err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// SerializeList returns the field value for list.
+func SerializeList(list List) (string, error) {
+	var (
+		b      strings.Builder
+		member Member
+		i      int
+		err    error
+	)
+
+	for i, member = range list {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		err = writeMember(&b, member)
+		if err != nil {
+			return "", err
+		}
+	}
+	return b.String(), nil
+}
+
+// SerializeDictionary returns the field value for dict. Members whose value
+// is the boolean true are written as a bare key with their parameters.
+func SerializeDictionary(dict Dictionary) (string, error) {
+	var (
+		b    strings.Builder
+		m    DictMember
+		item Item
+		ok   bool
+		i    int
+		err  error
+	)
+
+	for i, m = range dict {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		err = writeKey(&b, m.Key)
+		if err != nil {
+			return "", err
+		}
+		item, ok = m.Member.(Item)
+		if ok && item.Value == true {
+			err = writeParams(&b, item.Params)
+		} else {
+			b.WriteByte('=')
+			err = writeMember(&b, m.Member)
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+	return b.String(), nil
+}
+
+func writeMember(b *strings.Builder, member Member) error {
+	switch m := member.(type) {
+	case Item:
+		return writeItem(b, m)
+	case InnerList:
+		return writeInnerList(b, m)
+	}
+	return fmt.Errorf("error: unsupported structured field member %T", member)
+}
+
+func writeInnerList(b *strings.Builder, list InnerList) error {
+	var (
+		item Item
+		i    int
+		err  error
+	)
+
+	b.WriteByte('(')
+	for i, item = range list.Items {
+		if i > 0 {
+			b.WriteByte(' ')
+		}
+		err = writeItem(b, item)
+		if err != nil {
+			return err
+		}
+	}
+	b.WriteByte(')')
+	return writeParams(b, list.Params)
+}
+
+func writeItem(b *strings.Builder, item Item) error {
+	var err error
+
+	err = writeBareItem(b, item.Value)
+	if err != nil {
+		return err
+	}
+	return writeParams(b, item.Params)
+}
+
+func writeParams(b *strings.Builder, params Params) error {
+	var (
+		param Param
+		err   error
+	)
+
+	for _, param = range params {
+		b.WriteByte(';')
+		err = writeKey(b, param.Key)
+		if err != nil {
+			return err
+		}
+		if param.Value == true {
+			continue
+		}
+		b.WriteByte('=')
+		err = writeBareItem(b, param.Value)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeKey(b *strings.Builder, key string) error {
+	var i int
+
+	if key == "" || (!isLCAlpha(key[0]) && key[0] != '*') {
+		return fmt.Errorf("error: invalid structured field key %q", key)
+	}
+	for i = 1; i < len(key); i++ {
+		if !isKeyChar(key[i]) {
+			return fmt.Errorf("error: invalid structured field key %q", key)
+		}
+	}
+	b.WriteString(key)
+	return nil
+}
+
+func writeBareItem(b *strings.Builder, value BareItem) error {
+	switch v := value.(type) {
+	case int64:
+		return writeInteger(b, v)
+	case int:
+		return writeInteger(b, int64(v))
+	case float64:
+		return writeDecimal(b, v)
+	case string:
+		return writeString(b, v)
+	case Token:
+		return writeToken(b, v)
+	case []byte:
+		b.WriteByte(':')
+		b.WriteString(base64.StdEncoding.EncodeToString(v))
+		b.WriteByte(':')
+		return nil
+	case bool:
+		b.WriteByte('?')
+		if v {
+			b.WriteByte('1')
+		} else {
+			b.WriteByte('0')
+		}
+		return nil
+	}
+	return fmt.Errorf("error: unsupported structured field value %T", value)
+}
+
+func writeInteger(b *strings.Builder, v int64) error {
+	if v > maxInteger || v < -maxInteger {
+		return fmt.Errorf("error: integer %d out of range", v)
+	}
+	b.WriteString(strconv.FormatInt(v, 10))
+	return nil
+}
+
+// writeDecimal rounds v to three fractional digits, ties to even, and writes
+// it with at least one fractional digit.
+func writeDecimal(b *strings.Builder, v float64) error {
+	var text string
+
+	v = math.RoundToEven(v*decimalScale) / decimalScale
+	if math.IsNaN(v) || math.Abs(v) >= decimalLimit {
+		return fmt.Errorf("error: decimal %v out of range", v)
+	}
+	text = strconv.FormatFloat(v, 'f', -1, 64)
+	if !strings.Contains(text, ".") {
+		text += ".0"
+	}
+	b.WriteString(text)
+	return nil
+}
+
+func writeString(b *strings.Builder, v string) error {
+	var i int
+
+	b.WriteByte('"')
+	for i = 0; i < len(v); i++ {
+		if v[i] < 0x20 || v[i] > 0x7e {
+			return fmt.Errorf("error: invalid character %q in structured field string", v[i])
+		}
+		if v[i] == '"' || v[i] == '\\' {
+			b.WriteByte('\\')
+		}
+		b.WriteByte(v[i])
+	}
+	b.WriteByte('"')
+	return nil
+}
+
+func writeToken(b *strings.Builder, v Token) error {
+	var i int
+
+	if v == "" || (!isAlpha(v[0]) && v[0] != '*') {
+		return fmt.Errorf("error: invalid structured field token %q", v)
+	}
+	for i = 1; i < len(v); i++ {
+		if !isTokenChar(v[i]) {
+			return fmt.Errorf("error: invalid structured field token %q", v)
+		}
+	}
+	b.WriteString(string(v))
+	return nil
+}
@@ -0,0 +1,103 @@
+// Package sfv parses and serializes Structured Field Values for HTTP
+// (RFC 8941): Items, Lists and Dictionaries of integers, decimals, strings,
+// tokens, byte sequences and booleans, each with optional parameters.
+//
+// A field sent on several lines is parsed by joining the lines with ", "
+// first, as RFC 8941 section 4.2 requires.
+package sfv
+
+// Token is a bare item token such as `text/html` or `*foo`, kept apart from
+// String so the two serialize differently.
+type Token string
+
+// BareItem holds an int64, float64 (a decimal), string, Token, []byte or
+// bool.
+type BareItem any
+
+// Param is one parameter; a parameter written without a value is true.
+type Param struct {
+	Key   string
+	Value BareItem
+}
+
+// Params keeps parameters in the order they were written.
+type Params []Param
+
+// Member is a List or Dictionary member: an Item or an InnerList.
+type Member interface {
+	member()
+}
+
+type Item struct {
+	Value  BareItem
+	Params Params
+}
+
+type InnerList struct {
+	Items  []Item
+	Params Params
+}
+
+type List []Member
+
+// DictMember is one key of a Dictionary with its value.
+type DictMember struct {
+	Key    string
+	Member Member
+}
+
+// Dictionary keeps its members in the order they were written.
+type Dictionary []DictMember
+
+func (Item) member()      {}
+func (InnerList) member() {}
+
+// Get returns the value of the parameter key.
+func (p Params) Get(key string) (BareItem, bool) {
+	var param Param
+
+	for _, param = range p {
+		if param.Key == key {
+			return param.Value, true
+		}
+	}
+	return nil, false
+}
+
+// Get returns the member called key.
+func (d Dictionary) Get(key string) (Member, bool) {
+	var m DictMember
+
+	for _, m = range d {
+		if m.Key == key {
+			return m.Member, true
+		}
+	}
+	return nil, false
+}
+
+// set overwrites key in place if it is already present, as both parameters
+// and dictionaries require, and appends it otherwise.
+func (p Params) set(key string, value BareItem) Params {
+	var i int
+
+	for i = range p {
+		if p[i].Key == key {
+			p[i].Value = value
+			return p
+		}
+	}
+	return append(p, Param{Key: key, Value: value})
+}
+
+func (d Dictionary) set(key string, member Member) Dictionary {
+	var i int
+
+	for i = range d {
+		if d[i].Key == key {
+			d[i].Member = member
+			return d
+		}
+	}
+	return append(d, DictMember{Key: key, Member: member})
+}
@@ -0,0 +1,164 @@
+package sfv
+
+import (
+	"encoding/base32"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type vector struct {
+	Name       string   `json:"name"`
+	Raw        []string `json:"raw"`
+	HeaderType string   `json:"header_type"`
+	Expected   any      `json:"expected"`
+	MustFail   bool     `json:"must_fail"`
+	CanFail    bool     `json:"can_fail"`
+	Canonical  []string `json:"canonical"`
+}
+
+// The helpers below convert parsed values to the JSON shapes the test
+// vectors use.
+func bareToJSON(v BareItem) any {
+	switch v := v.(type) {
+	case int64:
+		return float64(v)
+	case Token:
+		return map[string]any{"__type": "token", "value": string(v)}
+	case []byte:
+		return map[string]any{"__type": "binary", "value": base32.StdEncoding.EncodeToString(v)}
+	}
+	return v
+}
+
+func paramsToJSON(params Params) any {
+	out := []any{}
+	for _, p := range params {
+		out = append(out, []any{p.Key, bareToJSON(p.Value)})
+	}
+	return out
+}
+
+func memberToJSON(m Member) any {
+	switch m := m.(type) {
+	case Item:
+		return []any{bareToJSON(m.Value), paramsToJSON(m.Params)}
+	case InnerList:
+		items := []any{}
+		for _, item := range m.Items {
+			items = append(items, memberToJSON(item))
+		}
+		return []any{items, paramsToJSON(m.Params)}
+	}
+	return nil
+}
+
+func parseVector(tc vector) (any, string, error) {
+	raw := strings.Join(tc.Raw, ", ")
+	switch tc.HeaderType {
+	case "item":
+		item, err := ParseItem(raw)
+		if err != nil {
+			return nil, "", err
+		}
+		serialized, err := SerializeItem(item)
+		return memberToJSON(item), serialized, err
+	case "list":
+		list, err := ParseList(raw)
+		if err != nil {
+			return nil, "", err
+		}
+		out := []any{}
+		for _, m := range list {
+			out = append(out, memberToJSON(m))
+		}
+		serialized, err := SerializeList(list)
+		return out, serialized, err
+	default:
+		dict, err := ParseDictionary(raw)
+		if err != nil {
+			return nil, "", err
+		}
+		out := []any{}
+		for _, m := range dict {
+			out = append(out, []any{m.Key, memberToJSON(m.Member)})
+		}
+		serialized, err := SerializeDictionary(dict)
+		return out, serialized, err
+	}
+}
+
+func TestVectors(t *testing.T) {
+	files, err := filepath.Glob(filepath.Join("testdata", "*.json"))
+	require.NoError(t, err)
+	require.NotEmpty(t, files)
+
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		require.NoError(t, err)
+		var vectors []vector
+		require.NoError(t, json.Unmarshal(data, &vectors), file)
+
+		for _, tc := range vectors {
+			t.Run(filepath.Base(file)+"/"+tc.Name, func(t *testing.T) {
+				got, serialized, err := parseVector(tc)
+				if tc.MustFail {
+					assert.Error(t, err)
+					return
+				}
+				if err != nil && tc.CanFail {
+					return
+				}
+				require.NoError(t, err)
+				assert.Equal(t, tc.Expected, got)
+
+				want := strings.Join(tc.Raw, ", ")
+				if tc.Canonical != nil {
+					want = strings.Join(tc.Canonical, ", ")
+				}
+				assert.Equal(t, want, serialized)
+			})
+		}
+	}
+}
+
+func TestSerializeErrors(t *testing.T) {
+	for _, v := range []BareItem{
+		int64(1_000_000_000_000_000),
+		int64(-1_000_000_000_000_000),
+		1e12,
+		"café",
+		"line\nbreak",
+		Token("1abc"),
+		Token("a b"),
+		Token(""),
+		3.5i,
+	} {
+		_, err := SerializeItem(Item{Value: v})
+		assert.Error(t, err, "%v", v)
+	}
+
+	_, err := SerializeDictionary(Dictionary{{Key: "Upper", Member: Item{Value: int64(1)}}})
+	assert.Error(t, err)
+	_, err = SerializeItem(Item{Value: int64(1), Params: Params{{Key: "", Value: true}}})
+	assert.Error(t, err)
+}
+
+func TestSerializeDecimalRounding(t *testing.T) {
+	for in, want := range map[float64]string{
+		1.0:     "1.0",
+		1.2345:  "1.234",
+		1.2355:  "1.236",
+		-0.0005: "-0.0",
+		42:      "42.0",
+	} {
+		got, err := SerializeItem(Item{Value: in})
+		require.NoError(t, err)
+		assert.Equal(t, want, got, in)
+	}
+}
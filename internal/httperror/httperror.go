@@ -0,0 +1,72 @@
+package httperror
+
+import "fmt"
+
+// Reason is a stable, machine-readable name for why a message was rejected.
+// Unlike the error text it is safe to match on and to expose in logs.
+type Reason string
+
+const (
+	ReasonInvalidRequestLine        Reason = "invalid-request-line"
+	ReasonInvalidMethod             Reason = "invalid-method"
+	ReasonInvalidTarget             Reason = "invalid-target"
+	ReasonInvalidVersion            Reason = "invalid-version"
+	ReasonUnsupportedVersion        Reason = "unsupported-version"
+	ReasonInvalidFieldLine          Reason = "invalid-field-line"
+	ReasonInvalidFieldName          Reason = "invalid-field-name"
+	ReasonInvalidFieldValue         Reason = "invalid-field-value"
+	ReasonInvalidContentLength      Reason = "invalid-content-length"
+	ReasonInvalidChunk              Reason = "invalid-chunk"
+	ReasonUnsupportedTransferCoding Reason = "unsupported-transfer-coding"
+	ReasonInvalidTransferEncoding   Reason = "invalid-transfer-encoding"
+	ReasonConflictingFraming        Reason = "conflicting-framing"
+	ReasonUnexpectedEOF             Reason = "unexpected-eof"
+	ReasonRequestLineTooLong        Reason = "request-line-too-long"
+	ReasonHeaderFieldsTooLarge      Reason = "header-fields-too-large"
+	ReasonContentTooLarge           Reason = "content-too-large"
+)
+
+const (
+	StatusBadRequest                  int = 400
+	StatusContentTooLarge             int = 413
+	StatusURITooLong                  int = 414
+	StatusRequestHeaderFieldsTooLarge int = 431
+	StatusNotImplemented              int = 501
+	StatusHTTPVersionNotSupported     int = 505
+)
+
+// ParseError is returned by the request and headers parsers. StatusCode is the
+// response the server should send, Offset the position of the offending byte
+// counted from the start of the message, and Detail a description meant for
+// logs rather than for the client.
+type ParseError struct {
+	StatusCode int
+	Reason     Reason
+	Offset     int
+	Detail     string
+}
+
+func New(statusCode int, reason Reason, offset int, format string, args ...any) *ParseError {
+	return &ParseError{
+		StatusCode: statusCode,
+		Reason:     reason,
+		Offset:     offset,
+		Detail:     fmt.Sprintf(format, args...),
+	}
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("%s at offset %d: %s", e.Reason, e.Offset, e.Detail)
+}
+
+// Is matches any ParseError with the same Reason, so a value such as
+// request.ErrContentTooLarge works as a sentinel with errors.Is.
+func (e *ParseError) Is(target error) bool {
+	var (
+		other *ParseError
+		ok    bool
+	)
+
+	other, ok = target.(*ParseError)
+	return ok && other.Reason == e.Reason
+}
@@ -0,0 +1,130 @@
+package request
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/RegistersNinja/httpfromtcp/internal/httperror"
+)
+
+// bodyReader decodes the request body on demand, running the same parser
+// state machine as RequestFromReader over the bytes left after the headers.
+type bodyReader struct {
+	req    *Request
+	closed bool
+}
+
+func (b *bodyReader) Read(p []byte) (int, error) {
+	if b.closed {
+		return 0, fmt.Errorf("error: read on closed body")
+	}
+	return b.req.readBody(p)
+}
+
+func (r *Request) readBody(p []byte) (int, error) {
+	var (
+		bytesParsed int
+		n           int
+		err         error
+	)
+
+	if r.bodyErr != nil {
+		return 0, r.bodyErr
+	}
+	for len(r.body) == 0 {
+		if r.state == done {
+			return 0, io.EOF
+		}
+
+		bytesParsed, err = r.parseBuffered()
+		if err != nil {
+			r.bodyErr = err
+			return 0, r.bodyErr
+		}
+		if bytesParsed > 0 {
+			continue
+		}
+
+		if r.srcErr == io.EOF {
+			if r.isParsingChunks() {
+				r.bodyErr = httperror.New(httperror.StatusBadRequest, httperror.ReasonUnexpectedEOF, r.offset+r.readToIndex,
+					"incomplete chunked body")
+			} else {
+				r.bodyErr = httperror.New(httperror.StatusBadRequest, httperror.ReasonUnexpectedEOF, r.offset+r.readToIndex,
+					"body shorter than Content-Length")
+			}
+			return 0, r.bodyErr
+		}
+		if r.srcErr != nil {
+			r.bodyErr = fmt.Errorf("read error: %w", r.srcErr)
+			return 0, r.bodyErr
+		}
+		if len(r.buf) < bodyBufferSize {
+			r.growBuffer(bodyBufferSize)
+		}
+		r.readMore()
+	}
+
+	n = copy(p, r.body)
+	r.body = r.body[n:]
+	return n, nil
+}
+
+func (b *bodyReader) Close() error {
+	b.closed = true
+	return nil
+}
+
+// ReadBody reads the whole body into memory. It is meant for handlers that
+// need the complete payload; repeated calls return the same bytes.
+func (r *Request) ReadBody() ([]byte, error) {
+	var err error
+
+	if r.bodyBuffered {
+		return r.bufferedBody, nil
+	}
+
+	r.bufferedBody, err = io.ReadAll(r.BodyReader)
+	if err != nil {
+		return nil, err
+	}
+	r.bodyBuffered = true
+	return r.bufferedBody, nil
+}
+
+// DiscardBody reads and drops up to limit bytes of whatever body the handler
+// left unread, even when BodyReader was closed, so the next request on the
+// connection can be parsed. It fails when more than limit bytes remain.
+func (r *Request) DiscardBody(limit int64) error {
+	var (
+		discarded int64
+		err       error
+	)
+
+	discarded, err = io.CopyN(io.Discard, readerFunc(r.readBody), limit+1)
+	if err == io.EOF {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return fmt.Errorf("error: more than %d unread body bytes left", discarded-1)
+}
+
+type readerFunc func(p []byte) (int, error)
+
+func (f readerFunc) Read(p []byte) (int, error) {
+	return f(p)
+}
+
+// BodyErr returns the error that ended reading the body, if any, so the server
+// can still answer a handler that gave up on a body over the size limit.
+func (r *Request) BodyErr() error {
+	return r.bodyErr
+}
+
+// BodyDone reports whether the whole request, body included, has been taken
+// off the connection, so anything arriving afterwards belongs to the next one.
+func (r *Request) BodyDone() bool {
+	return r.state == done
+}
@@ -0,0 +1,179 @@
+package request
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/RegistersNinja/httpfromtcp/internal/httperror"
+)
+
+// FramingMode decides what happens to a request carrying both
+// Transfer-Encoding and Content-Length, the classic request smuggling vector.
+type FramingMode int
+
+const (
+	// FramingStrict rejects such requests with 400.
+	FramingStrict FramingMode = iota
+	// FramingLenient drops Content-Length, decodes the body as chunked and
+	// closes the connection after responding, as RFC 9112 section 6.3 allows.
+	FramingLenient
+)
+
+const (
+	codingParamSeparator string = ";"
+	fieldValueSeparator  string = ", "
+)
+
+// combinedField joins the values of every name field line, which is how
+// repeated list-based fields such as Transfer-Encoding are to be read.
+func (r *Request) combinedField(name string) (string, bool) {
+	var values []string
+
+	values = r.Headers.Values(name)
+	return strings.Join(values, fieldValueSeparator), len(values) > 0
+}
+
+// determineFraming applies the message body length rules of RFC 9112
+// section 6.3 once the header section is complete and moves the parser to the
+// matching body state.
+func (r *Request) determineFraming() error {
+	var (
+		teValue string
+		hasTE   bool
+		clValue string
+		hasCL   bool
+		length  int
+		err     error
+	)
+
+	teValue, hasTE = r.combinedField(teHeader)
+	clValue, hasCL = r.combinedField(clHeader)
+
+	if hasTE {
+		err = checkTransferCodings(teValue)
+		if err != nil {
+			return err
+		}
+		if r.RequestLine.HttpVersion == HTTPVersion10 {
+			// Transfer-Encoding did not exist in HTTP/1.0, so the framing may
+			// have been altered by an intermediary (RFC 9112 section 6.1).
+			r.requiresClose = true
+		}
+		if hasCL {
+			if r.framing == FramingStrict {
+				return conflictingFraming("both Transfer-Encoding and Content-Length are present")
+			}
+			r.Headers.Del(clHeader)
+			r.requiresClose = true
+		}
+		r.state = stateParsingChunkSize
+		return nil
+	}
+
+	if !hasCL {
+		r.state = done
+		return nil
+	}
+	if clValue == emptyStr && r.framing == FramingLenient {
+		// An empty Content-Length is invalid; lenient mode reads it as absent.
+		r.state = done
+		return nil
+	}
+
+	length, err = parseContentLength(clValue)
+	if err != nil {
+		return err
+	}
+	err = r.checkBody(int64(length))
+	if err != nil {
+		return err
+	}
+
+	r.contentLength = length
+	if length == 0 {
+		r.state = done
+	} else {
+		r.state = stateParsingBody
+	}
+	return nil
+}
+
+// parseContentLength accepts a single decimal length or a list of identical
+// ones, which is what duplicate Content-Length fields fold into. Signs,
+// whitespace inside the number and differing values are rejected.
+func parseContentLength(value string) (int, error) {
+	var (
+		part   string
+		length int
+		first  int
+		i      int
+		err    error
+	)
+
+	for i, part = range strings.Split(value, codingSeparator) {
+		part = strings.TrimSpace(part)
+		if !isDigits(part) {
+			return 0, httperror.New(httperror.StatusBadRequest, httperror.ReasonInvalidContentLength, 0,
+				"invalid Content-Length: %q", value)
+		}
+		length, err = strconv.Atoi(part)
+		if err != nil {
+			return 0, httperror.New(httperror.StatusBadRequest, httperror.ReasonInvalidContentLength, 0,
+				"invalid Content-Length: %q", value)
+		}
+		if i == 0 {
+			first = length
+		} else if length != first {
+			return 0, conflictingFraming("differing Content-Length values: %q", value)
+		}
+	}
+	return first, nil
+}
+
+// checkTransferCodings requires chunked to be applied exactly once and last,
+// since otherwise the body length cannot be determined, and answers 501 for
+// any other coding because chunked is the only one implemented.
+func checkTransferCodings(value string) error {
+	var (
+		codings []string
+		coding  string
+		name    string
+		i       int
+	)
+
+	for _, coding = range strings.Split(value, codingSeparator) {
+		name, _, _ = strings.Cut(coding, codingParamSeparator)
+		name = strings.TrimSpace(name)
+		if name != emptyStr {
+			codings = append(codings, name)
+		}
+	}
+	if len(codings) == 0 {
+		return invalidTransferEncoding("empty Transfer-Encoding")
+	}
+
+	for i, coding = range codings {
+		if !strings.EqualFold(coding, chunkedCoding) {
+			return httperror.New(httperror.StatusNotImplemented, httperror.ReasonUnsupportedTransferCoding, 0,
+				"unsupported transfer coding: %q", coding)
+		}
+		if i != len(codings)-1 {
+			return invalidTransferEncoding("chunked must be applied once, as the final transfer coding: %q", value)
+		}
+	}
+	return nil
+}
+
+func invalidTransferEncoding(format string, args ...any) error {
+	return httperror.New(httperror.StatusBadRequest, httperror.ReasonInvalidTransferEncoding, 0, format, args...)
+}
+
+func conflictingFraming(format string, args ...any) error {
+	return httperror.New(httperror.StatusBadRequest, httperror.ReasonConflictingFraming, 0, format, args...)
+}
+
+// RequiresClose reports whether the connection has to be closed after this
+// request whatever the client asked for, because its framing was repaired.
+func (r *Request) RequiresClose() bool {
+	return r.requiresClose
+}
@@ -0,0 +1,91 @@
+package request
+
+import "github.com/RegistersNinja/httpfromtcp/internal/httperror"
+
+const (
+	defaultMaxRequestLineBytes int = 8 * 1024
+	defaultMaxHeaderBytes      int = 64 * 1024
+	defaultMaxHeaderCount      int = 100
+	maxChunkLineBytes          int = 4 * 1024
+)
+
+// Sentinels for errors.Is; the errors actually returned are fresh
+// *httperror.ParseError values carrying the offset.
+var (
+	ErrRequestLineTooLong = &httperror.ParseError{
+		StatusCode: httperror.StatusURITooLong,
+		Reason:     httperror.ReasonRequestLineTooLong,
+		Detail:     "request line too long",
+	}
+	ErrHeaderFieldsTooLarge = &httperror.ParseError{
+		StatusCode: httperror.StatusRequestHeaderFieldsTooLarge,
+		Reason:     httperror.ReasonHeaderFieldsTooLarge,
+		Detail:     "request header fields too large",
+	}
+	ErrContentTooLarge = &httperror.ParseError{
+		StatusCode: httperror.StatusContentTooLarge,
+		Reason:     httperror.ReasonContentTooLarge,
+		Detail:     "request content too large",
+	}
+)
+
+// Limits bounds how much of a request the parser accepts. A zero field means
+// no limit. The header limits cover the trailer section as well.
+type Limits struct {
+	MaxRequestLineBytes int
+	MaxHeaderBytes      int
+	MaxHeaderCount      int
+	MaxBodyBytes        int64
+}
+
+// Options configures RequestFromReaderWithOptions.
+type Options struct {
+	Limits  Limits
+	Framing FramingMode
+}
+
+// DefaultLimits leaves the body unbounded since it is streamed to the handler
+// rather than buffered.
+func DefaultLimits() Limits {
+	return Limits{
+		MaxRequestLineBytes: defaultMaxRequestLineBytes,
+		MaxHeaderBytes:      defaultMaxHeaderBytes,
+		MaxHeaderCount:      defaultMaxHeaderCount,
+	}
+}
+
+func DefaultOptions() Options {
+	return Options{Limits: DefaultLimits()}
+}
+
+// checkRequestLine checks the length of a complete request line or, while the
+// line is still incomplete, of the bytes buffered so far.
+func (r *Request) checkRequestLine(lineLength int) error {
+	if r.limits.MaxRequestLineBytes > 0 && lineLength > r.limits.MaxRequestLineBytes {
+		return httperror.New(httperror.StatusURITooLong, httperror.ReasonRequestLineTooLong, r.limits.MaxRequestLineBytes,
+			"request line longer than %d bytes", r.limits.MaxRequestLineBytes)
+	}
+	return nil
+}
+
+// checkHeaders checks the field lines parsed so far plus pending bytes of a
+// field line that has not been terminated yet.
+func (r *Request) checkHeaders(pending int) error {
+	if r.limits.MaxHeaderBytes > 0 && r.headerBytes+pending > r.limits.MaxHeaderBytes {
+		return httperror.New(httperror.StatusRequestHeaderFieldsTooLarge, httperror.ReasonHeaderFieldsTooLarge, 0,
+			"header section larger than %d bytes", r.limits.MaxHeaderBytes)
+	}
+	if r.limits.MaxHeaderCount > 0 && r.headerCount > r.limits.MaxHeaderCount {
+		return httperror.New(httperror.StatusRequestHeaderFieldsTooLarge, httperror.ReasonHeaderFieldsTooLarge, 0,
+			"more than %d header fields", r.limits.MaxHeaderCount)
+	}
+	return nil
+}
+
+func (r *Request) checkBody(length int64) error {
+	if r.limits.MaxBodyBytes > 0 && length > r.limits.MaxBodyBytes {
+		return httperror.New(httperror.StatusContentTooLarge, httperror.ReasonContentTooLarge, 0,
+			"body larger than %d bytes", r.limits.MaxBodyBytes)
+	}
+	return nil
+}
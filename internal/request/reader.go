@@ -0,0 +1,64 @@
+package request
+
+import "io"
+
+const waitBufferSize int = 512
+
+// Reader wraps a connection so that bytes read past the end of one request
+// are handed to the next RequestFromReader call instead of being lost. The
+// server reads every request on a persistent connection through one Reader.
+type Reader struct {
+	src     io.Reader
+	pending []byte
+}
+
+func NewReader(src io.Reader) *Reader {
+	return &Reader{src: src}
+}
+
+func (r *Reader) Read(p []byte) (int, error) {
+	var n int
+
+	if len(r.pending) > 0 {
+		n = copy(p, r.pending)
+		r.pending = r.pending[n:]
+		return n, nil
+	}
+	return r.src.Read(p)
+}
+
+// unread puts bytes back in front of whatever is still pending.
+func (r *Reader) unread(data []byte) {
+	var pending []byte
+
+	if len(data) == 0 {
+		return
+	}
+	pending = make([]byte, 0, len(data)+len(r.pending))
+	pending = append(pending, data...)
+	r.pending = append(pending, r.pending...)
+}
+
+// Wait blocks until at least one byte of the next request is available and
+// keeps it pending, so a server can tell a connection that is idle apart from
+// one that is sending a request. It returns the read error if nothing arrives.
+func (r *Reader) Wait() error {
+	var (
+		buf []byte
+		n   int
+		err error
+	)
+
+	if len(r.pending) > 0 {
+		return nil
+	}
+	buf = make([]byte, waitBufferSize)
+	for n == 0 {
+		n, err = r.src.Read(buf)
+		if n == 0 && err != nil {
+			return err
+		}
+	}
+	r.unread(buf[:n])
+	return nil
+}
@@ -1,46 +1,103 @@
 package request
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"strconv"
 	"strings"
 
 	"github.com/RegistersNinja/httpfromtcp/internal/headers"
+	"github.com/RegistersNinja/httpfromtcp/internal/httperror"
 )
 
 const (
 	httpVer                    string = "1.1"
+	HTTPVersion11              string = httpVer
+	HTTPVersion10              string = "1.0"
 	forwardSlash               string = "/"
 	numberOfPartsInRequestLine int    = 3
 	methodPart                 int    = 0
 	pathPart                   int    = 1
 	versionPart                int    = 2
-	httpVersion                int    = 1
+	httpVersionPrefix          string = "HTTP/"
+	versionSeparator           string = "."
+	decimalDigits              string = "0123456789"
 	bufferSize                 int    = 8
+	bodyBufferSize             int    = 32 * 1024
 	initialized                int    = 0
 	done                       int    = 1
 	stateParsingHeaders        int    = 2
 	stateParsingBody           int    = 3
+	stateParsingChunkSize      int    = 4
+	stateParsingChunkData      int    = 5
+	stateParsingChunkDataEnd   int    = 6
+	stateParsingTrailers       int    = 7
 	twice                      int    = 2
 	ExitError                  int    = 1
 	ExitSuccess                int    = 0
 	newLine                    string = "\r\n"
 	zeroBytesParsed            int    = 0
 	clHeader                   string = "Content-Length"
+	teHeader                   string = "Transfer-Encoding"
+	chunkedCoding              string = "chunked"
+	chunkExtSeparator          string = ";"
+	chunkExtAssign             string = "="
+	bws                        string = " \t"
+	hexDigits                  string = "0123456789abcdefABCDEF"
+	tokenChars                 string = "!#$%&'*+-.^_`|~"
+	codingSeparator            string = ","
+	hexBase                    int    = 16
+	chunkSizeBits              int    = 64
 	emptyStr                   string = ""
 )
 
-func getHTTPVerbs() []string {
-	return []string{"GET", "HEAD", "POST", "OPTIONS", "PUT", "DELETE", "TRACE", "CONNECT"}
+// Request is returned as soon as the request line and headers are parsed.
+// The body is decoded lazily through BodyReader; Trailers are populated once
+// a chunked body has been read to the end.
+type Request struct {
+	RequestLine   RequestLine
+	Target        Target
+	Headers       *headers.Headers
+	BodyReader    io.ReadCloser
+	Trailers      *headers.Headers
+	state         int
+	chunkSize     int
+	limits        Limits
+	framing       FramingMode
+	requiresClose bool
+	headerBytes   int
+	headerCount   int
+
+	contentLength   int
+	bodyBytesParsed int
+	body            []byte
+	bufferedBody    []byte
+	bodyBuffered    bool
+
+	src         io.Reader
+	srcErr      error
+	bodyErr     error
+	buf         []byte
+	readToIndex int
+	offset      int
+
+	ctx context.Context
+}
 
+// Context returns the request's context, which the server cancels when the
+// client goes away or the request is over. It is never nil.
+func (r *Request) Context() context.Context {
+	if r.ctx == nil {
+		return context.Background()
+	}
+	return r.ctx
 }
 
-type Request struct {
-	RequestLine RequestLine
-	Headers     headers.Headers
-	Body        string
-	state       int
+// SetContext replaces the request's context.
+func (r *Request) SetContext(ctx context.Context) {
+	r.ctx = ctx
 }
 
 type RequestLine struct {
@@ -49,19 +106,58 @@ type RequestLine struct {
 	Method        string
 }
 
+// isValidHTTPVerb only checks the syntax: RFC 9110 section 9 lets a method be
+// any token. Whether the server implements it is up to the server.
 func isValidHTTPVerb(method string) bool {
-	var verb string
+	return isToken(method)
+}
+
+func isToken(s string) bool {
+	var c rune
 
-	for _, verb = range getHTTPVerbs() {
-		if method == verb {
-			return true
+	if s == emptyStr {
+		return false
+	}
+	for _, c = range s {
+		if !('a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || strings.ContainsRune(tokenChars, c)) {
+			return false
 		}
 	}
-	return false
+	return true
 }
 
 func isValidHTTPVer(version string) bool {
-	return version == httpVer
+	return version == HTTPVersion11 || version == HTTPVersion10
+}
+
+func isDigits(s string) bool {
+	return s != emptyStr && strings.Trim(s, decimalDigits) == emptyStr
+}
+
+// parseHTTPVersion checks the "HTTP/" major "." minor syntax and then whether
+// the version is one this server speaks, answering 505 if it is not. The
+// minor part may be missing so that "HTTP/2" is reported as unsupported
+// rather than malformed.
+func parseHTTPVersion(versionPart string, offset int) (string, error) {
+	var (
+		version string
+		major   string
+		minor   string
+		ok      bool
+		found   bool
+	)
+
+	version, ok = strings.CutPrefix(versionPart, httpVersionPrefix)
+	major, minor, found = strings.Cut(version, versionSeparator)
+	if !ok || !isDigits(major) || (found && !isDigits(minor)) {
+		return emptyStr, httperror.New(httperror.StatusBadRequest, httperror.ReasonInvalidVersion, offset,
+			"malformed HTTP version: %q", versionPart)
+	}
+	if !isValidHTTPVer(version) {
+		return emptyStr, httperror.New(httperror.StatusHTTPVersionNotSupported, httperror.ReasonUnsupportedVersion, offset,
+			"unsupported HTTP version, expected %s or %s, got: %s", HTTPVersion11, HTTPVersion10, versionPart)
+	}
+	return version, nil
 }
 
 func (r *Request) parse(data []byte) (int, error) {
@@ -70,21 +166,32 @@ func (r *Request) parse(data []byte) (int, error) {
 		reqLine         RequestLine
 		err             error
 		status          bool
-		clValue         string
-		clStr           string
-		contentLength   int
 		bodyBytesParsed int
 	)
 
 	switch r.state {
 	case initialized:
+		if strings.HasPrefix(string(data), newLine) {
+			// RFC 9112 section 2.2: ignore empty lines ahead of the request line,
+			// some clients send an extra CRLF after a request body.
+			return len(newLine), nil
+		}
 		reqLine, bytesParsed, err = parseRequestLine(data)
 
 		if err != nil {
 			return zeroBytesParsed, err
 		}
 		if bytesParsed == 0 {
-			return zeroBytesParsed, nil
+			return zeroBytesParsed, r.checkRequestLine(len(data))
+		}
+		err = r.checkRequestLine(bytesParsed - len(newLine))
+		if err != nil {
+			return zeroBytesParsed, err
+		}
+
+		r.Target, err = parseTarget(reqLine.Method, reqLine.RequestTarget)
+		if err != nil {
+			return zeroBytesParsed, shiftOffset(err, len(reqLine.Method)+1)
 		}
 
 		r.RequestLine = reqLine
@@ -96,51 +203,64 @@ func (r *Request) parse(data []byte) (int, error) {
 		if err != nil {
 			return zeroBytesParsed, err
 		}
-		if bytesParsed == 0 {
-			return zeroBytesParsed, nil
+		err = r.countFieldLine(bytesParsed, status, len(data))
+		if err != nil || bytesParsed == 0 {
+			return zeroBytesParsed, err
 		}
 		if status {
-			clValue, _ = r.Headers.Get(clHeader)
-			if clValue == emptyStr {
-				// No Content-Length provided: treat as zero-length body and finish.
-				r.state = done
-			} else {
-				contentLength, err = strconv.Atoi(clValue)
-				if err != nil {
-					return zeroBytesParsed, fmt.Errorf("invalid Content-Length: %q", clValue)
-				}
-				if contentLength < 0 {
-					return zeroBytesParsed, fmt.Errorf("expected non negative values for length but got %d", contentLength)
-				}
-
-				if contentLength == 0 {
-					r.state = done
-				} else {
-					r.state = stateParsingBody
-				}
+			err = r.determineFraming()
+			if err != nil {
+				return zeroBytesParsed, err
 			}
 		}
 		return bytesParsed, nil
 
 	case stateParsingBody:
-		clStr, _ = r.Headers.Get(clHeader)
-		contentLength, err = strconv.Atoi(clStr)
-		if err != nil {
-			return zeroBytesParsed, fmt.Errorf("invalid Content-Length: %q", clStr)
+		bodyBytesParsed = min(r.contentLength-r.bodyBytesParsed, len(data))
+		r.body = append(r.body, data[:bodyBytesParsed]...)
+		r.bodyBytesParsed += bodyBytesParsed
+		if r.bodyBytesParsed == r.contentLength {
+			r.state = done
 		}
-		if contentLength < 0 {
-			return zeroBytesParsed, fmt.Errorf("expected non negative values for length but got %d", contentLength)
+		return bodyBytesParsed, nil
+
+	case stateParsingChunkSize:
+		return r.parseChunkSize(data)
+
+	case stateParsingChunkData:
+		bodyBytesParsed = min(r.chunkSize, len(data))
+		r.body = append(r.body, data[:bodyBytesParsed]...)
+		r.bodyBytesParsed += bodyBytesParsed
+		r.chunkSize -= bodyBytesParsed
+		if r.chunkSize == 0 {
+			r.state = stateParsingChunkDataEnd
 		}
+		return bodyBytesParsed, nil
 
-		bodyBytesParsed = min(contentLength-len(r.Body), len(data))
-		if bodyBytesParsed < 0 {
-			bodyBytesParsed = 0
+	case stateParsingChunkDataEnd:
+		if len(data) < len(newLine) {
+			return zeroBytesParsed, nil
+		}
+		if string(data[:len(newLine)]) != newLine {
+			return zeroBytesParsed, invalidChunk(0, "chunk data not terminated by CRLF")
+		}
+		r.state = stateParsingChunkSize
+		return len(newLine), nil
+
+	case stateParsingTrailers:
+		bytesParsed, status, err = r.Trailers.Parse(data)
+		if err != nil {
+			return zeroBytesParsed, err
+		}
+		err = r.countFieldLine(bytesParsed, status, len(data))
+		if err != nil {
+			return zeroBytesParsed, err
 		}
-		r.Body += string(data[:bodyBytesParsed])
-		if len(r.Body) == contentLength {
+		if status {
 			r.state = done
 		}
-		return bodyBytesParsed, nil
+		return bytesParsed, nil
+
 	case done:
 		return zeroBytesParsed, fmt.Errorf("error: trying to read data in a done state")
 	default:
@@ -149,6 +269,100 @@ func (r *Request) parse(data []byte) (int, error) {
 
 }
 
+// countFieldLine accounts for one field line (or the empty line ending the
+// section) against the header limits. When no line was complete, the whole
+// buffered data is an unfinished field line.
+func (r *Request) countFieldLine(bytesParsed int, sectionDone bool, buffered int) error {
+	if bytesParsed == 0 {
+		return r.checkHeaders(buffered)
+	}
+	r.headerBytes += bytesParsed
+	if !sectionDone {
+		r.headerCount++
+	}
+	return r.checkHeaders(0)
+}
+
+func invalidChunk(offset int, format string, args ...any) error {
+	return httperror.New(httperror.StatusBadRequest, httperror.ReasonInvalidChunk, offset, format, args...)
+}
+
+// shiftOffset moves the offset of a ParseError reported relative to part of
+// the data to be relative to the start of the data.
+func shiftOffset(err error, by int) error {
+	var perr *httperror.ParseError
+
+	if errors.As(err, &perr) {
+		perr.Offset += by
+	}
+	return err
+}
+
+func (r *Request) isParsingChunks() bool {
+	switch r.state {
+	case stateParsingChunkSize, stateParsingChunkData, stateParsingChunkDataEnd, stateParsingTrailers:
+		return true
+	}
+	return false
+}
+
+// parseChunkSize consumes a chunk-size line (chunk-size [ chunk-ext ] CRLF).
+// Chunk extensions are validated and then ignored, as RFC 9112 allows.
+func (r *Request) parseChunkSize(data []byte) (int, error) {
+	var (
+		lineEnd       int
+		line          string
+		sizePart      string
+		extensions    string
+		extension     string
+		extName       string
+		hasExtensions bool
+		size          int64
+		err           error
+	)
+
+	lineEnd = strings.Index(string(data), newLine)
+	if lineEnd < 0 {
+		if len(data) > maxChunkLineBytes {
+			return zeroBytesParsed, invalidChunk(maxChunkLineBytes, "chunk size line longer than %d bytes", maxChunkLineBytes)
+		}
+		return zeroBytesParsed, nil
+	}
+	line = string(data[:lineEnd])
+
+	sizePart, extensions, hasExtensions = strings.Cut(line, chunkExtSeparator)
+	sizePart = strings.TrimRight(sizePart, bws)
+	if sizePart == emptyStr || strings.TrimLeft(sizePart, hexDigits) != emptyStr {
+		return zeroBytesParsed, invalidChunk(0, "invalid chunk size: %q", line)
+	}
+	size, err = strconv.ParseInt(sizePart, hexBase, chunkSizeBits)
+	if err != nil {
+		return zeroBytesParsed, invalidChunk(0, "invalid chunk size: %q", line)
+	}
+
+	if hasExtensions {
+		for _, extension = range strings.Split(extensions, chunkExtSeparator) {
+			extName, _, _ = strings.Cut(extension, chunkExtAssign)
+			if !isToken(strings.Trim(extName, bws)) {
+				return zeroBytesParsed, invalidChunk(len(sizePart), "invalid chunk extension: %q", line)
+			}
+		}
+	}
+
+	err = r.checkBody(int64(r.bodyBytesParsed) + size)
+	if err != nil {
+		return zeroBytesParsed, err
+	}
+
+	if size == 0 {
+		r.state = stateParsingTrailers
+	} else {
+		r.chunkSize = int(size)
+		r.state = stateParsingChunkData
+	}
+	return lineEnd + len(newLine), nil
+}
+
 func parseRequestLine(data []byte) (RequestLine, int, error) {
 	var (
 		dataNewLineSplit []string
@@ -158,6 +372,7 @@ func parseRequestLine(data []byte) (RequestLine, int, error) {
 		version          string
 		bytesRead        int
 		parts            []string
+		err              error
 	)
 	bytesRead = 0
 	dataNewLineSplit = strings.Split(string(data), newLine)
@@ -170,19 +385,21 @@ func parseRequestLine(data []byte) (RequestLine, int, error) {
 	bytesRead = len(requestLine) + len(newLine)
 	parts = strings.Split(requestLine, " ")
 	if len(parts) != numberOfPartsInRequestLine {
-		return RequestLine{}, bytesRead, fmt.Errorf("incorrect request line: expected %d parts, got %d", numberOfPartsInRequestLine, len(parts))
+		return RequestLine{}, bytesRead, httperror.New(httperror.StatusBadRequest, httperror.ReasonInvalidRequestLine, 0,
+			"incorrect request line: expected %d parts, got %d", numberOfPartsInRequestLine, len(parts))
 	}
 
 	method = parts[methodPart]
 	target = parts[pathPart]
-	version = strings.Split(parts[versionPart], forwardSlash)[httpVersion]
 
-	if !isValidHTTPVerb(parts[methodPart]) {
-		return RequestLine{}, bytesRead, fmt.Errorf("invalid HTTP method: %s", parts[methodPart])
+	if !isValidHTTPVerb(method) {
+		return RequestLine{}, bytesRead, httperror.New(httperror.StatusBadRequest, httperror.ReasonInvalidMethod, 0,
+			"invalid HTTP method: %s", method)
 	}
 
-	if !isValidHTTPVer(version) {
-		return RequestLine{}, bytesRead, fmt.Errorf("invalid HTTP version, expected %s, got: %s", httpVer, parts[versionPart])
+	version, err = parseHTTPVersion(parts[versionPart], len(method)+len(target)+2)
+	if err != nil {
+		return RequestLine{}, bytesRead, err
 	}
 	return RequestLine{
 		Method:        method,
@@ -191,85 +408,124 @@ func parseRequestLine(data []byte) (RequestLine, int, error) {
 	}, bytesRead, nil
 }
 
+func (r *Request) headersParsed() bool {
+	return r.state != initialized && r.state != stateParsingHeaders
+}
+
+// parseBuffered runs the parser once over the buffered bytes and drops
+// whatever it consumed from the front of the buffer.
+func (r *Request) parseBuffered() (int, error) {
+	var (
+		bytesParsed int
+		err         error
+	)
+
+	bytesParsed, err = r.parse(r.buf[:r.readToIndex])
+	if err != nil {
+		return zeroBytesParsed, shiftOffset(err, r.offset)
+	}
+	r.offset += bytesParsed
+	copy(r.buf, r.buf[bytesParsed:r.readToIndex])
+	clear(r.buf[r.readToIndex-bytesParsed : r.readToIndex])
+	r.readToIndex -= bytesParsed
+	if r.state == done {
+		r.returnLeftover()
+	}
+	return bytesParsed, nil
+}
+
+// returnLeftover hands the bytes buffered past the end of this request back to
+// the source when it is a Reader, so a pipelined request is not lost.
+func (r *Request) returnLeftover() {
+	var (
+		connReader *Reader
+		ok         bool
+	)
+
+	connReader, ok = r.src.(*Reader)
+	if !ok || r.readToIndex == 0 {
+		return
+	}
+	connReader.unread(r.buf[:r.readToIndex])
+	clear(r.buf[:r.readToIndex])
+	r.readToIndex = 0
+}
+
+func (r *Request) growBuffer(size int) {
+	var biggerBuf []byte
+
+	biggerBuf = make([]byte, size)
+	copy(biggerBuf, r.buf[:r.readToIndex])
+	r.buf = biggerBuf
+}
+
+// readMore reads from the source into the free space of the buffer, growing it
+// when full. A read error is kept in srcErr so the bytes that came with it are
+// still parsed before the error is acted upon.
+func (r *Request) readMore() {
+	var bytesRead int
+
+	if r.readToIndex == len(r.buf) {
+		r.growBuffer(twice * len(r.buf))
+	}
+
+	bytesRead, r.srcErr = r.src.Read(r.buf[r.readToIndex:])
+	r.readToIndex += bytesRead
+}
+
+// RequestFromReader parses the request line and headers from reader. Passing a
+// *Reader lets consecutive calls read pipelined requests from one connection.
+// When the source ends before any byte of a request, the source error (such
+// as io.EOF) is returned unwrapped.
 func RequestFromReader(reader io.Reader) (*Request, error) {
+	return RequestFromReaderWithOptions(reader, DefaultOptions())
+}
+
+// RequestFromReaderWithOptions is RequestFromReader with explicit parser
+// limits. Exceeding one returns an error wrapping ErrRequestLineTooLong,
+// ErrHeaderFieldsTooLarge or ErrContentTooLarge.
+func RequestFromReaderWithOptions(reader io.Reader, opts Options) (*Request, error) {
 	var (
-		buf           []byte
-		biggerBuf     []byte
-		readToIndex   int
-		bytesRead     int
 		bytesParsed   int
 		err           error
 		parsedRequest *Request
-		clStr         string
-		contentLength int
 	)
 
-	buf = make([]byte, bufferSize)
-	readToIndex = 0
 	parsedRequest = &Request{
-		state:   initialized,
-		Headers: headers.NewHeaders(),
+		state:    initialized,
+		Headers:  headers.NewHeaders(),
+		Trailers: headers.NewHeaders(),
+		src:      reader,
+		limits:   opts.Limits,
+		framing:  opts.Framing,
+		buf:      make([]byte, bufferSize),
 	}
+	parsedRequest.BodyReader = &bodyReader{req: parsedRequest}
 
-	for parsedRequest.state != done {
-		if readToIndex == len(buf) {
-			biggerBuf = make([]byte, twice*len(buf))
-			copy(biggerBuf, buf[:readToIndex])
-			buf = biggerBuf
-		}
-
-		bytesRead, err = reader.Read(buf[readToIndex:])
+	for !parsedRequest.headersParsed() {
+		bytesParsed, err = parsedRequest.parseBuffered()
 		if err != nil {
-			if err == io.EOF {
-				if readToIndex > 0 {
-					for {
-						if parsedRequest.state == done {
-							break
-						}
-						bytesParsed, err = parsedRequest.parse(buf[:readToIndex])
-						if err != nil {
-							return nil, fmt.Errorf("parse error: %s", err)
-						}
-						if bytesParsed == 0 {
-							break
-						}
-						copy(buf, buf[bytesParsed:readToIndex])
-						clear(buf[readToIndex-bytesParsed : readToIndex])
-						readToIndex -= bytesParsed
-					}
-				}
-				if parsedRequest.state == stateParsingBody {
-					clStr, _ = parsedRequest.Headers.Get(clHeader)
-					contentLength, err = strconv.Atoi(clStr)
-					if err != nil || contentLength < 0 {
-						return nil, fmt.Errorf("invalid Content-Length: %q", clStr)
-					}
-					if len(parsedRequest.Body) < contentLength {
-						return nil, fmt.Errorf("unexpected EOF: body shorter than Content-Length")
-					}
-				}
-				break
-			}
-
-			return nil, fmt.Errorf("read error: %s", err)
+			return nil, err
+		}
+		if bytesParsed > 0 {
+			continue
 		}
-		readToIndex += bytesRead
 
-		for {
-			bytesParsed, err = parsedRequest.parse(buf[:readToIndex])
-			if err != nil {
-				return nil, fmt.Errorf("parse error: %s", err)
-			}
-			if bytesParsed == 0 {
-				break
-			}
-			copy(buf, buf[bytesParsed:readToIndex])
-			clear(buf[readToIndex-bytesParsed : readToIndex])
-			readToIndex -= bytesParsed
-			if parsedRequest.state == done {
-				break
-			}
+		if parsedRequest.srcErr != nil && parsedRequest.state == initialized && parsedRequest.readToIndex == 0 {
+			// Nothing of a new request arrived: report the bare error so a
+			// persistent connection can tell a clean close from a bad request.
+			return nil, parsedRequest.srcErr
+		}
+		if parsedRequest.srcErr == io.EOF {
+			// The message ended before the header section did: keep what was
+			// parsed and treat the request as having no body.
+			parsedRequest.state = done
+			break
+		}
+		if parsedRequest.srcErr != nil {
+			return nil, fmt.Errorf("read error: %w", parsedRequest.srcErr)
 		}
+		parsedRequest.readMore()
 	}
 
 	return parsedRequest, nil
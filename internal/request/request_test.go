@@ -1,10 +1,14 @@
 package request
 
 import (
+	"errors"
 	"io"
 	"strings"
 	"testing"
 
+	"github.com/RegistersNinja/httpfromtcp/internal/headers"
+	"github.com/RegistersNinja/httpfromtcp/internal/httperror"
+
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -31,6 +35,18 @@ func (cr *chunkReader) Read(p []byte) (n int, err error) {
 	return n, nil
 }
 
+func fieldValue(h *headers.Headers, key string) string {
+	value, _ := h.Get(key)
+	return value
+}
+
+func readBody(t *testing.T, r *Request) string {
+	t.Helper()
+	body, err := r.ReadBody()
+	require.NoError(t, err)
+	return string(body)
+}
+
 func TestRequestLineParse(t *testing.T) {
 	// Test: Good GET Request line
 	r, err := RequestFromReader(strings.NewReader("GET / HTTP/1.1\r\nHost: localhost:42069\r\nUser-Agent: curl/7.81.0\r\nAccept: */*\r\n\r\n"))
@@ -103,16 +119,16 @@ func TestRequestHeaders(t *testing.T) {
 		r, err := RequestFromReader(reader)
 		require.NoError(t, err)
 		require.NotNil(t, r)
-		assert.Equal(t, "localhost:42069", r.Headers["host"])
-		assert.Equal(t, "curl/7.81.0", r.Headers["user-agent"])
-		assert.Equal(t, "*/*", r.Headers["accept"])
+		assert.Equal(t, "localhost:42069", fieldValue(r.Headers, "host"))
+		assert.Equal(t, "curl/7.81.0", fieldValue(r.Headers, "user-agent"))
+		assert.Equal(t, "*/*", fieldValue(r.Headers, "accept"))
 	})
 
 	t.Run("Empty Headers", func(t *testing.T) {
 		r, err := RequestFromReader(strings.NewReader("GET / HTTP/1.1\r\n\r\n"))
 		require.NoError(t, err)
 		require.NotNil(t, r)
-		assert.Len(t, r.Headers, 0)
+		assert.Equal(t, 0, r.Headers.Len())
 	})
 
 	t.Run("Malformed Header", func(t *testing.T) {
@@ -132,7 +148,7 @@ func TestRequestHeaders(t *testing.T) {
 		r, err := RequestFromReader(reader)
 		require.NoError(t, err)
 		require.NotNil(t, r)
-		assert.Equal(t, "1, 2", r.Headers["x"])
+		assert.Equal(t, []string{"1", "2"}, r.Headers.Values("x"))
 	})
 
 	t.Run("Case Insensitive Headers", func(t *testing.T) {
@@ -143,7 +159,7 @@ func TestRequestHeaders(t *testing.T) {
 		r, err := RequestFromReader(reader)
 		require.NoError(t, err)
 		require.NotNil(t, r)
-		assert.Equal(t, "A, B, C", r.Headers["host"]) // key normalized to lowercase
+		assert.Equal(t, []string{"A", "B", "C"}, r.Headers.Values("host"))
 	})
 
 	t.Run("Missing End of Headers", func(t *testing.T) {
@@ -156,7 +172,7 @@ func TestRequestHeaders(t *testing.T) {
 		// Current behavior: returns successfully with parsed headers
 		require.NoError(t, err)
 		require.NotNil(t, r)
-		assert.Equal(t, "example.com", r.Headers["host"])
+		assert.Equal(t, "example.com", fieldValue(r.Headers, "host"))
 	})
 }
 
@@ -173,7 +189,7 @@ func TestRequestBody(t *testing.T) {
     r, err := RequestFromReader(reader)
     require.NoError(t, err)
     require.NotNil(t, r)
-    assert.Equal(t, "hello world!\n", r.Body)
+    assert.Equal(t, "hello world!\n", readBody(t, r))
 
     // Test: Empty Body, 0 reported content length (valid)
     reader = &chunkReader{
@@ -186,9 +202,9 @@ func TestRequestBody(t *testing.T) {
     r, err = RequestFromReader(reader)
     require.NoError(t, err)
     require.NotNil(t, r)
-    assert.Equal(t, "", r.Body)
+    assert.Equal(t, "", readBody(t, r))
 
-    // Test: Content-Length present but empty, with body bytes following (valid; body ignored)
+    // Test: Content-Length present but empty is invalid framing (RFC 9112 section 6.3)
     reader = &chunkReader{
         data: "POST /submit HTTP/1.1\r\n" +
             "Host: localhost:42069\r\n" +
@@ -197,11 +213,23 @@ func TestRequestBody(t *testing.T) {
             "test",
         numBytesPerRead: 2,
     }
-    r, err = RequestFromReader(reader)
+    _, err = RequestFromReader(reader)
+    require.Error(t, err)
+
+    // Test: Content-Length present but empty, with body bytes following (valid in lenient mode; body ignored)
+    reader = &chunkReader{
+        data: "POST /submit HTTP/1.1\r\n" +
+            "Host: localhost:42069\r\n" +
+            "Content-Length: \r\n" + // empty value
+            "\r\n" +
+            "test",
+        numBytesPerRead: 2,
+    }
+    r, err = RequestFromReaderWithOptions(reader, Options{Limits: DefaultLimits(), Framing: FramingLenient})
     require.NoError(t, err)
     require.NotNil(t, r)
-    assert.Equal(t, "", r.Body)
-    assert.Equal(t, "", r.Headers["content-length"]) // header captured as empty string
+    assert.Equal(t, "", readBody(t, r))
+    assert.Equal(t, "", fieldValue(r.Headers, "content-length")) // header captured as empty string
 
     // Test: Empty Body, no reported content length (valid)
     reader = &chunkReader{
@@ -213,7 +241,7 @@ func TestRequestBody(t *testing.T) {
     r, err = RequestFromReader(reader)
     require.NoError(t, err)
     require.NotNil(t, r)
-    assert.Equal(t, "", r.Body)
+    assert.Equal(t, "", readBody(t, r))
 
     // Test: Body shorter than reported content length
     reader = &chunkReader{
@@ -224,7 +252,9 @@ func TestRequestBody(t *testing.T) {
             "partial content",
         numBytesPerRead: 3,
     }
-    _, err = RequestFromReader(reader)
+    r, err = RequestFromReader(reader)
+    require.NoError(t, err)
+    _, err = r.ReadBody()
     require.Error(t, err)
 
     // Test: No Content-Length but Body Exists (shouldn't error)
@@ -238,5 +268,439 @@ func TestRequestBody(t *testing.T) {
     r, err = RequestFromReader(reader)
     require.NoError(t, err)
     require.NotNil(t, r)
-    assert.Equal(t, "", r.Body)
+    assert.Equal(t, "", readBody(t, r))
+}
+
+func TestRequestChunkedBody(t *testing.T) {
+	t.Run("Chunked Body", func(t *testing.T) {
+		reader := &chunkReader{
+			data: "POST /submit HTTP/1.1\r\n" +
+				"Host: localhost:42069\r\n" +
+				"Transfer-Encoding: chunked\r\n" +
+				"\r\n" +
+				"5\r\nhello\r\n" +
+				"7\r\n world!\r\n" +
+				"0\r\n" +
+				"\r\n",
+			numBytesPerRead: 3,
+		}
+		r, err := RequestFromReader(reader)
+		require.NoError(t, err)
+		require.NotNil(t, r)
+		assert.Equal(t, "hello world!", readBody(t, r))
+		assert.Equal(t, 0, r.Trailers.Len())
+	})
+
+	t.Run("Chunk Extensions And Trailers", func(t *testing.T) {
+		reader := &chunkReader{
+			data: "POST /submit HTTP/1.1\r\n" +
+				"Host: localhost:42069\r\n" +
+				"Transfer-Encoding: chunked\r\n" +
+				"\r\n" +
+				"A;name=value;flag\r\n0123456789\r\n" +
+				"0\r\n" +
+				"X-Content-Length: 10\r\n" +
+				"\r\n",
+			numBytesPerRead: 4,
+		}
+		r, err := RequestFromReader(reader)
+		require.NoError(t, err)
+		require.NotNil(t, r)
+		assert.Equal(t, "0123456789", readBody(t, r))
+		assert.Equal(t, "10", fieldValue(r.Trailers, "x-content-length"))
+	})
+
+	t.Run("Chunked Takes Precedence Over Content-Length", func(t *testing.T) {
+		r, err := RequestFromReaderWithOptions(strings.NewReader("POST /submit HTTP/1.1\r\n"+
+			"Transfer-Encoding: chunked\r\n"+
+			"Content-Length: 100\r\n"+
+			"\r\n"+
+			"3\r\nabc\r\n0\r\n\r\n"), Options{Framing: FramingLenient})
+		require.NoError(t, err)
+		require.NotNil(t, r)
+		assert.Equal(t, "abc", readBody(t, r))
+	})
+
+	t.Run("Invalid Chunk Size", func(t *testing.T) {
+		r, err := RequestFromReader(strings.NewReader("POST /submit HTTP/1.1\r\n" +
+			"Transfer-Encoding: chunked\r\n" +
+			"\r\n" +
+			"zz\r\nabc\r\n0\r\n\r\n"))
+		require.NoError(t, err)
+		_, err = r.ReadBody()
+		require.Error(t, err)
+	})
+
+	t.Run("Missing CRLF After Chunk Data", func(t *testing.T) {
+		r, err := RequestFromReader(strings.NewReader("POST /submit HTTP/1.1\r\n" +
+			"Transfer-Encoding: chunked\r\n" +
+			"\r\n" +
+			"3\r\nabcdef\r\n0\r\n\r\n"))
+		require.NoError(t, err)
+		_, err = r.ReadBody()
+		require.Error(t, err)
+	})
+
+	t.Run("Missing Terminating Chunk", func(t *testing.T) {
+		reader := &chunkReader{
+			data: "POST /submit HTTP/1.1\r\n" +
+				"Transfer-Encoding: chunked\r\n" +
+				"\r\n" +
+				"3\r\nabc\r\n",
+			numBytesPerRead: 5,
+		}
+		r, err := RequestFromReader(reader)
+		require.NoError(t, err)
+		_, err = r.ReadBody()
+		require.Error(t, err)
+	})
+}
+
+func TestRequestStreamingBody(t *testing.T) {
+	t.Run("Returns Before Body Is Read", func(t *testing.T) {
+		pr, pw := io.Pipe()
+		go func() {
+			_, _ = pw.Write([]byte("POST /upload HTTP/1.1\r\nContent-Length: 10\r\n\r\n01234"))
+		}()
+
+		r, err := RequestFromReader(pr)
+		require.NoError(t, err)
+		require.NotNil(t, r)
+
+		go func() {
+			_, _ = pw.Write([]byte("56789"))
+			_ = pw.Close()
+		}()
+		assert.Equal(t, "0123456789", readBody(t, r))
+	})
+
+	t.Run("Small Reads", func(t *testing.T) {
+		r, err := RequestFromReader(strings.NewReader("POST /upload HTTP/1.1\r\n" +
+			"Transfer-Encoding: chunked\r\n" +
+			"\r\n" +
+			"4\r\nabcd\r\n3\r\nefg\r\n0\r\n\r\n"))
+		require.NoError(t, err)
+		buf := make([]byte, 2)
+		var got []byte
+		for {
+			n, err := r.BodyReader.Read(buf)
+			got = append(got, buf[:n]...)
+			if err == io.EOF {
+				break
+			}
+			require.NoError(t, err)
+		}
+		assert.Equal(t, "abcdefg", string(got))
+	})
+
+	t.Run("ReadBody Is Repeatable", func(t *testing.T) {
+		r, err := RequestFromReader(strings.NewReader("POST /upload HTTP/1.1\r\nContent-Length: 3\r\n\r\nabc"))
+		require.NoError(t, err)
+		assert.Equal(t, "abc", readBody(t, r))
+		assert.Equal(t, "abc", readBody(t, r))
+	})
+
+	t.Run("Read After Close", func(t *testing.T) {
+		r, err := RequestFromReader(strings.NewReader("POST /upload HTTP/1.1\r\nContent-Length: 3\r\n\r\nabc"))
+		require.NoError(t, err)
+		require.NoError(t, r.BodyReader.Close())
+		_, err = r.BodyReader.Read(make([]byte, 1))
+		require.Error(t, err)
+	})
+}
+
+func TestRequestPipelining(t *testing.T) {
+	reader := NewReader(&chunkReader{
+		data: "\r\nPOST /first HTTP/1.1\r\nContent-Length: 3\r\n\r\nabc" +
+			"GET /second HTTP/1.1\r\nHost: localhost\r\n\r\n" +
+			"POST /third HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\n1\r\nz\r\n0\r\n\r\n",
+		numBytesPerRead: 64,
+	})
+
+	r, err := RequestFromReader(reader)
+	require.NoError(t, err)
+	assert.Equal(t, "/first", r.RequestLine.RequestTarget)
+	assert.Equal(t, "abc", readBody(t, r))
+
+	r, err = RequestFromReader(reader)
+	require.NoError(t, err)
+	assert.Equal(t, "/second", r.RequestLine.RequestTarget)
+
+	r, err = RequestFromReader(reader)
+	require.NoError(t, err)
+	assert.Equal(t, "/third", r.RequestLine.RequestTarget)
+	require.NoError(t, r.DiscardBody(1024))
+
+	_, err = RequestFromReader(reader)
+	assert.Equal(t, io.EOF, err)
+}
+
+func TestRequestTarget(t *testing.T) {
+	t.Run("Origin Form With Query", func(t *testing.T) {
+		r, err := RequestFromReader(strings.NewReader("GET /video%20clips/a?x=1&tag=a&tag=b%2Cc HTTP/1.1\r\nHost: localhost\r\n\r\n"))
+		require.NoError(t, err)
+		assert.Equal(t, OriginForm, r.Target.Form)
+		assert.Equal(t, "/video clips/a", r.Path())
+		assert.Equal(t, "/video%20clips/a", r.Target.RawPath)
+		assert.Equal(t, "x=1&tag=a&tag=b%2Cc", r.RawQuery())
+		assert.Equal(t, "1", r.Query("x"))
+		assert.Equal(t, []string{"a", "b,c"}, r.QueryValues("tag"))
+		assert.Empty(t, r.QueryValues("missing"))
+	})
+
+	t.Run("Query With Semicolons", func(t *testing.T) {
+		r, err := RequestFromReader(strings.NewReader("GET /?a=1;b=2&c HTTP/1.1\r\nHost: localhost\r\n\r\n"))
+		require.NoError(t, err)
+		assert.Equal(t, "a=1;b=2&c", r.RawQuery())
+		assert.Equal(t, "1;b=2", r.Query("a"))
+		assert.Equal(t, []string{""}, r.QueryValues("c"))
+	})
+
+	t.Run("Absolute Form", func(t *testing.T) {
+		r, err := RequestFromReader(strings.NewReader("GET http://example.com:8080?q=go HTTP/1.1\r\nHost: example.com:8080\r\n\r\n"))
+		require.NoError(t, err)
+		assert.Equal(t, AbsoluteForm, r.Target.Form)
+		assert.Equal(t, "http", r.Target.Scheme)
+		assert.Equal(t, "example.com:8080", r.Target.Host)
+		assert.Equal(t, "/", r.Path())
+		assert.Equal(t, "go", r.Query("q"))
+	})
+
+	t.Run("Authority Form", func(t *testing.T) {
+		r, err := RequestFromReader(strings.NewReader("CONNECT example.com:443 HTTP/1.1\r\nHost: example.com:443\r\n\r\n"))
+		require.NoError(t, err)
+		assert.Equal(t, AuthorityForm, r.Target.Form)
+		assert.Equal(t, "example.com:443", r.Target.Host)
+		assert.Equal(t, "", r.Path())
+	})
+
+	t.Run("Asterisk Form", func(t *testing.T) {
+		r, err := RequestFromReader(strings.NewReader("OPTIONS * HTTP/1.1\r\nHost: localhost\r\n\r\n"))
+		require.NoError(t, err)
+		assert.Equal(t, AsteriskForm, r.Target.Form)
+	})
+
+	t.Run("Malformed Targets", func(t *testing.T) {
+		for _, line := range []string{
+			"GET * HTTP/1.1",
+			"GET /bad%zz HTTP/1.1",
+			"GET /frag#ment HTTP/1.1",
+			"GET /\"quoted\" HTTP/1.1",
+			"GET example.com HTTP/1.1",
+			"CONNECT /path HTTP/1.1",
+			"CONNECT example.com:99999 HTTP/1.1",
+		} {
+			_, err := RequestFromReader(strings.NewReader(line + "\r\nHost: localhost\r\n\r\n"))
+			assert.Error(t, err, line)
+		}
+	})
+}
+
+func TestRequestLimits(t *testing.T) {
+	limits := Limits{
+		MaxRequestLineBytes: 32,
+		MaxHeaderBytes:      64,
+		MaxHeaderCount:      3,
+		MaxBodyBytes:        8,
+	}
+	parse := func(data string) (*Request, error) {
+		return RequestFromReaderWithOptions(&chunkReader{data: data, numBytesPerRead: 7}, Options{Limits: limits})
+	}
+
+	t.Run("Within Limits", func(t *testing.T) {
+		r, err := parse("POST /a HTTP/1.1\r\nHost: x\r\nContent-Length: 8\r\n\r\n01234567")
+		require.NoError(t, err)
+		assert.Equal(t, "01234567", readBody(t, r))
+	})
+
+	t.Run("Request Line Too Long", func(t *testing.T) {
+		_, err := parse("GET /" + strings.Repeat("a", 64) + " HTTP/1.1\r\nHost: x\r\n\r\n")
+		require.ErrorIs(t, err, ErrRequestLineTooLong)
+
+		// The limit applies before the line is terminated too.
+		_, err = parse("GET /" + strings.Repeat("a", 1024))
+		require.ErrorIs(t, err, ErrRequestLineTooLong)
+	})
+
+	t.Run("Header Section Too Large", func(t *testing.T) {
+		_, err := parse("GET / HTTP/1.1\r\nX-Long: " + strings.Repeat("v", 128) + "\r\n\r\n")
+		require.ErrorIs(t, err, ErrHeaderFieldsTooLarge)
+	})
+
+	t.Run("Too Many Headers", func(t *testing.T) {
+		_, err := parse("GET / HTTP/1.1\r\nA: 1\r\nB: 2\r\nC: 3\r\nD: 4\r\n\r\n")
+		require.ErrorIs(t, err, ErrHeaderFieldsTooLarge)
+	})
+
+	t.Run("Content-Length Too Large", func(t *testing.T) {
+		_, err := parse("POST / HTTP/1.1\r\nContent-Length: 9\r\n\r\n012345678")
+		require.ErrorIs(t, err, ErrContentTooLarge)
+	})
+
+	t.Run("Chunked Body Too Large", func(t *testing.T) {
+		r, err := parse("POST / HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\n5\r\n01234\r\n5\r\n56789\r\n0\r\n\r\n")
+		require.NoError(t, err)
+		_, err = r.ReadBody()
+		require.ErrorIs(t, err, ErrContentTooLarge)
+		require.ErrorIs(t, r.BodyErr(), ErrContentTooLarge)
+	})
+}
+
+func TestRequestParseErrors(t *testing.T) {
+	parseError := func(t *testing.T, data string) *httperror.ParseError {
+		t.Helper()
+		_, err := RequestFromReader(&chunkReader{data: data, numBytesPerRead: 5})
+		require.Error(t, err)
+		var perr *httperror.ParseError
+		require.True(t, errors.As(err, &perr), "expected a ParseError, got %T", err)
+		return perr
+	}
+
+	tests := []struct {
+		name   string
+		data   string
+		status int
+		reason httperror.Reason
+		offset int
+	}{
+		{"Bad Request Line", "GET /\r\n\r\n", 400, httperror.ReasonInvalidRequestLine, 0},
+		{"Bad Method", "G@T / HTTP/1.1\r\n\r\n", 400, httperror.ReasonInvalidMethod, 0},
+		{"Bad Target", "GET /a b HTTP/1.1\r\n\r\n", 400, httperror.ReasonInvalidRequestLine, 0},
+		{"Bad Target Character", "GET /a\"b HTTP/1.1\r\n\r\n", 400, httperror.ReasonInvalidTarget, 6},
+		{"Malformed Version", "GET / HTTX/1.1\r\n\r\n", 400, httperror.ReasonInvalidVersion, 6},
+		{"Unsupported Version", "GET / HTTP/2.0\r\n\r\n", 505, httperror.ReasonUnsupportedVersion, 6},
+		{"Bad Field Name", "GET / HTTP/1.1\r\nHost: x\r\nB@d: 1\r\n\r\n", 400, httperror.ReasonInvalidFieldName, 25},
+		{"Bad Content-Length", "POST / HTTP/1.1\r\nContent-Length: ten\r\n\r\n", 400, httperror.ReasonInvalidContentLength, 38},
+		{"Unknown Transfer Coding", "POST / HTTP/1.1\r\nTransfer-Encoding: gzip\r\n\r\n", 501, httperror.ReasonUnsupportedTransferCoding, 42},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			perr := parseError(t, tc.data)
+			assert.Equal(t, tc.status, perr.StatusCode)
+			assert.Equal(t, tc.reason, perr.Reason)
+			assert.Equal(t, tc.offset, perr.Offset)
+		})
+	}
+
+	t.Run("Body Errors", func(t *testing.T) {
+		r, err := RequestFromReader(strings.NewReader("POST / HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\n3\r\nabcdef"))
+		require.NoError(t, err)
+		_, err = r.ReadBody()
+		var perr *httperror.ParseError
+		require.True(t, errors.As(err, &perr))
+		assert.Equal(t, httperror.ReasonInvalidChunk, perr.Reason)
+		assert.Equal(t, 53, perr.Offset)
+	})
+}
+
+func TestRequestFraming(t *testing.T) {
+	lenient := Options{Limits: DefaultLimits(), Framing: FramingLenient}
+	tests := []struct {
+		name    string
+		headers string
+		body    string
+		opts    Options
+		reason  httperror.Reason
+		status  int
+		want    string
+	}{
+		{name: "Identical Duplicate Content-Length", headers: "Content-Length: 3\r\nContent-Length: 3\r\n", body: "abc", want: "abc"},
+		{name: "Identical Content-Length List", headers: "Content-Length: 3, 3\r\n", body: "abc", want: "abc"},
+		{name: "Differing Duplicate Content-Length", headers: "Content-Length: 3\r\nContent-Length: 10\r\n", body: "abc", reason: httperror.ReasonConflictingFraming, status: 400},
+		{name: "Signed Content-Length", headers: "Content-Length: +3\r\n", body: "abc", reason: httperror.ReasonInvalidContentLength, status: 400},
+		{name: "Negative Content-Length", headers: "Content-Length: -3\r\n", body: "abc", reason: httperror.ReasonInvalidContentLength, status: 400},
+		{name: "Hex Content-Length", headers: "Content-Length: 0x3\r\n", body: "abc", reason: httperror.ReasonInvalidContentLength, status: 400},
+		{name: "Overflowing Content-Length", headers: "Content-Length: 99999999999999999999999\r\n", body: "abc", reason: httperror.ReasonInvalidContentLength, status: 400},
+		{name: "CL And TE Strict", headers: "Content-Length: 3\r\nTransfer-Encoding: chunked\r\n", body: "3\r\nabc\r\n0\r\n\r\n", reason: httperror.ReasonConflictingFraming, status: 400},
+		{name: "TE And CL Strict", headers: "Transfer-Encoding: chunked\r\nContent-Length: 3\r\n", body: "3\r\nabc\r\n0\r\n\r\n", reason: httperror.ReasonConflictingFraming, status: 400},
+		{name: "CL And TE Lenient", headers: "Content-Length: 3\r\nTransfer-Encoding: chunked\r\n", body: "5\r\nabcde\r\n0\r\n\r\n", opts: lenient, want: "abcde"},
+		{name: "Chunked Not Final", headers: "Transfer-Encoding: chunked, gzip\r\n", body: "3\r\nabc\r\n0\r\n\r\n", reason: httperror.ReasonInvalidTransferEncoding, status: 400},
+		{name: "Chunked Twice", headers: "Transfer-Encoding: chunked\r\nTransfer-Encoding: chunked\r\n", body: "3\r\nabc\r\n0\r\n\r\n", reason: httperror.ReasonInvalidTransferEncoding, status: 400},
+		{name: "Unknown Coding", headers: "Transfer-Encoding: gzip, chunked\r\n", body: "3\r\nabc\r\n0\r\n\r\n", reason: httperror.ReasonUnsupportedTransferCoding, status: 501},
+		{name: "Unknown Coding Without Chunked", headers: "Transfer-Encoding: identity\r\n", body: "abc", reason: httperror.ReasonUnsupportedTransferCoding, status: 501},
+		{name: "Empty Transfer-Encoding", headers: "Transfer-Encoding: \r\n", body: "abc", reason: httperror.ReasonInvalidTransferEncoding, status: 400},
+		{name: "Case Insensitive Chunked", headers: "Transfer-Encoding: Chunked\r\n", body: "3\r\nabc\r\n0\r\n\r\n", want: "abc"},
+		{name: "Leading Whitespace Transfer-Encoding", headers: " Transfer-Encoding: chunked\r\n", body: "3\r\nabc\r\n0\r\n\r\n", reason: httperror.ReasonInvalidFieldLine, status: 400},
+		{name: "Obs-Fold Continuation", headers: "X-Foo: a\r\n\tTransfer-Encoding: chunked\r\n", body: "3\r\nabc\r\n0\r\n\r\n", reason: httperror.ReasonInvalidFieldLine, status: 400},
+		{name: "Bare CR In Value", headers: "X-Foo: a\rb\r\n", reason: httperror.ReasonInvalidFieldValue, status: 400},
+		{name: "NUL In Value", headers: "X-Foo: a\x00b\r\n", reason: httperror.ReasonInvalidFieldValue, status: 400},
+		{name: "Tab In Value", headers: "X-Foo: a\tb\r\nContent-Length: 3\r\n", body: "abc", want: "abc"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			opts := tc.opts
+			if opts == (Options{}) {
+				opts = DefaultOptions()
+			}
+			data := "POST /submit HTTP/1.1\r\nHost: localhost\r\n" + tc.headers + "\r\n" + tc.body
+			r, err := RequestFromReaderWithOptions(&chunkReader{data: data, numBytesPerRead: 6}, opts)
+			if tc.reason != "" {
+				var perr *httperror.ParseError
+				require.True(t, errors.As(err, &perr), "expected a ParseError, got %v", err)
+				assert.Equal(t, tc.reason, perr.Reason)
+				assert.Equal(t, tc.status, perr.StatusCode)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, readBody(t, r))
+		})
+	}
+
+	t.Run("Lenient Repair Closes Connection", func(t *testing.T) {
+		r, err := RequestFromReaderWithOptions(strings.NewReader("POST / HTTP/1.1\r\n"+
+			"Content-Length: 3\r\nTransfer-Encoding: chunked\r\n\r\n0\r\n\r\n"), lenient)
+		require.NoError(t, err)
+		assert.True(t, r.RequiresClose())
+		_, ok := r.Headers.Get("Content-Length")
+		assert.False(t, ok)
+	})
+}
+
+func TestRequestHTTPVersions(t *testing.T) {
+	r, err := RequestFromReader(strings.NewReader("GET / HTTP/1.0\r\n\r\n"))
+	require.NoError(t, err)
+	assert.Equal(t, HTTPVersion10, r.RequestLine.HttpVersion)
+	assert.False(t, r.RequiresClose())
+
+	r, err = RequestFromReader(strings.NewReader("POST / HTTP/1.0\r\nTransfer-Encoding: chunked\r\n\r\n1\r\na\r\n0\r\n\r\n"))
+	require.NoError(t, err)
+	assert.Equal(t, "a", readBody(t, r))
+	assert.True(t, r.RequiresClose())
+
+	for _, version := range []string{"HTTP/2.0", "HTTP/0.9", "HTTP/1.2", "HTTP/10.1"} {
+		_, err = RequestFromReader(strings.NewReader("GET / " + version + "\r\n\r\n"))
+		var perr *httperror.ParseError
+		require.True(t, errors.As(err, &perr), version)
+		assert.Equal(t, 505, perr.StatusCode, version)
+	}
+
+	for _, version := range []string{"HTTP/1.x", "HTTP/", "http/1.1", "HTTP/1.1.1", "HTTP"} {
+		_, err = RequestFromReader(strings.NewReader("GET / " + version + "\r\n\r\n"))
+		var perr *httperror.ParseError
+		require.True(t, errors.As(err, &perr), version)
+		assert.Equal(t, 400, perr.StatusCode, version)
+	}
+}
+
+func TestRequestMethods(t *testing.T) {
+	for _, method := range []string{"PATCH", "PROPFIND", "MKCOL", "BREW", "get"} {
+		r, err := RequestFromReader(strings.NewReader(method + " / HTTP/1.1\r\nHost: localhost\r\n\r\n"))
+		require.NoError(t, err, method)
+		assert.Equal(t, method, r.RequestLine.Method)
+	}
+
+	for _, method := range []string{"GE(T", "G\"T", "M{}"} {
+		_, err := RequestFromReader(strings.NewReader(method + " / HTTP/1.1\r\nHost: localhost\r\n\r\n"))
+		require.Error(t, err, method)
+	}
+}
+
+func TestReaderWait(t *testing.T) {
+	reader := NewReader(&chunkReader{data: "GET / HTTP/1.1\r\nHost: localhost\r\n\r\n", numBytesPerRead: 3})
+	require.NoError(t, reader.Wait())
+	require.NoError(t, reader.Wait())
+	r, err := RequestFromReader(reader)
+	require.NoError(t, err)
+	assert.Equal(t, "/", r.RequestLine.RequestTarget)
+	assert.Equal(t, io.EOF, reader.Wait())
 }
@@ -0,0 +1,240 @@
+package request
+
+import (
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/RegistersNinja/httpfromtcp/internal/httperror"
+)
+
+// TargetForm is one of the four request-target forms of RFC 9112 section 3.2.
+type TargetForm int
+
+const (
+	OriginForm TargetForm = iota
+	AbsoluteForm
+	AuthorityForm
+	AsteriskForm
+)
+
+const (
+	asteriskTarget     string = "*"
+	querySeparator     string = "?"
+	querySeparatorPair string = "&"
+	queryAssign        string = "="
+	connectMethod      string = "CONNECT"
+	optionsMethod      string = "OPTIONS"
+	percent            byte   = '%'
+	pctEncodedLength   int    = 3
+	maxPort            int    = 65535
+	// unreserved, sub-delims, ":" and "@" (pchar without pct-encoded) plus the
+	// "/" and "?" allowed in paths and queries.
+	targetChars string = "-._~!$&'()*+,;=:@/?"
+)
+
+// Target is the parsed request-target. Path is percent-decoded; RawPath and
+// RawQuery keep the bytes as sent. Scheme and Host are only set for the
+// absolute and authority forms.
+type Target struct {
+	Form     TargetForm
+	Scheme   string
+	Host     string
+	Path     string
+	RawPath  string
+	RawQuery string
+	query    url.Values
+}
+
+// invalidTarget reports a malformed target; offset is counted from the start
+// of the target and shifted to the message offset by the caller.
+func invalidTarget(offset int, format string, args ...any) error {
+	return httperror.New(httperror.StatusBadRequest, httperror.ReasonInvalidTarget, offset, format, args...)
+}
+
+func isTargetChar(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || strings.IndexByte(targetChars, c) >= 0
+}
+
+func isHexDigit(c byte) bool {
+	return strings.IndexByte(hexDigits, c) >= 0
+}
+
+// validateTargetChars checks that target only holds characters allowed in a
+// path or query and that every "%" starts a complete pct-encoded octet.
+func validateTargetChars(target string) error {
+	var i int
+
+	for i = 0; i < len(target); i++ {
+		if target[i] == percent {
+			if i+pctEncodedLength > len(target) || !isHexDigit(target[i+1]) || !isHexDigit(target[i+2]) {
+				return invalidTarget(i, "invalid percent-encoding in request target: %q", target)
+			}
+			i += pctEncodedLength - 1
+			continue
+		}
+		if !isTargetChar(target[i]) {
+			return invalidTarget(i, "invalid character %q in request target: %q", target[i], target)
+		}
+	}
+	return nil
+}
+
+func parseTarget(method string, target string) (Target, error) {
+	switch {
+	case target == asteriskTarget:
+		if method != optionsMethod {
+			return Target{}, invalidTarget(0, "asterisk-form request target is only allowed for %s", optionsMethod)
+		}
+		return Target{Form: AsteriskForm}, nil
+	case method == connectMethod:
+		return parseAuthorityForm(target)
+	case strings.HasPrefix(target, forwardSlash):
+		return parseOriginForm(target)
+	default:
+		return parseAbsoluteForm(target)
+	}
+}
+
+func parseOriginForm(target string) (Target, error) {
+	var (
+		parsed Target
+		err    error
+	)
+
+	err = validateTargetChars(target)
+	if err != nil {
+		return Target{}, err
+	}
+
+	parsed.Form = OriginForm
+	parsed.RawPath, parsed.RawQuery, _ = strings.Cut(target, querySeparator)
+	err = parsed.decode()
+	if err != nil {
+		return Target{}, err
+	}
+	return parsed, nil
+}
+
+func parseAbsoluteForm(target string) (Target, error) {
+	var (
+		parsed Target
+		u      *url.URL
+		err    error
+	)
+
+	u, err = url.Parse(target)
+	if err != nil || u.Scheme == emptyStr || u.Opaque != emptyStr || u.Fragment != emptyStr || u.User != nil {
+		return Target{}, invalidTarget(0, "invalid request target: %q", target)
+	}
+	err = validateTargetChars(u.EscapedPath() + querySeparator + u.RawQuery)
+	if err != nil {
+		return Target{}, err
+	}
+
+	parsed = Target{
+		Form:     AbsoluteForm,
+		Scheme:   strings.ToLower(u.Scheme),
+		Host:     u.Host,
+		RawPath:  u.EscapedPath(),
+		RawQuery: u.RawQuery,
+	}
+	if parsed.RawPath == emptyStr {
+		parsed.RawPath = forwardSlash
+	}
+	err = parsed.decode()
+	if err != nil {
+		return Target{}, err
+	}
+	return parsed, nil
+}
+
+func parseAuthorityForm(target string) (Target, error) {
+	var (
+		host string
+		port string
+		n    int
+		err  error
+	)
+
+	host, port, err = net.SplitHostPort(target)
+	if err != nil || host == emptyStr {
+		return Target{}, invalidTarget(0, "%s requires an authority-form request target, got: %q", connectMethod, target)
+	}
+	n, err = strconv.Atoi(port)
+	if err != nil || n < 0 || n > maxPort {
+		return Target{}, invalidTarget(0, "invalid port in request target: %q", target)
+	}
+	return Target{Form: AuthorityForm, Host: target}, nil
+}
+
+func (t *Target) decode() error {
+	var err error
+
+	t.Path, err = url.PathUnescape(t.RawPath)
+	if err != nil {
+		return invalidTarget(0, "invalid request target path: %q", t.RawPath)
+	}
+	t.query = parseQuery(t.RawQuery)
+	return nil
+}
+
+// parseQuery decodes query as name=value pairs separated by "&". Unlike
+// url.ParseQuery it treats ";" as data, since RFC 3986 leaves the query
+// syntax to the application; the characters were already validated.
+func parseQuery(query string) url.Values {
+	var (
+		values url.Values
+		pair   string
+		name   string
+		value  string
+	)
+
+	values = url.Values{}
+	for query != emptyStr {
+		pair, query, _ = strings.Cut(query, querySeparatorPair)
+		if pair == emptyStr {
+			continue
+		}
+		name, value, _ = strings.Cut(pair, queryAssign)
+		values.Add(queryUnescape(name), queryUnescape(value))
+	}
+	return values
+}
+
+// queryUnescape decodes s, keeping it as sent if it does not decode.
+func queryUnescape(s string) string {
+	var (
+		decoded string
+		err     error
+	)
+
+	decoded, err = url.QueryUnescape(s)
+	if err != nil {
+		return s
+	}
+	return decoded
+}
+
+// Path returns the percent-decoded path of the request target. It is empty
+// for the authority and asterisk forms.
+func (r *Request) Path() string {
+	return r.Target.Path
+}
+
+// RawQuery returns the query of the request target as sent, without the "?".
+func (r *Request) RawQuery() string {
+	return r.Target.RawQuery
+}
+
+// Query returns the first value of the query parameter key, or "".
+func (r *Request) Query(key string) string {
+	return r.Target.query.Get(key)
+}
+
+// QueryValues returns every value of the query parameter key in the order
+// they appear in the request target.
+func (r *Request) QueryValues(key string) []string {
+	return r.Target.query[key]
+}
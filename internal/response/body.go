@@ -0,0 +1,265 @@
+package response
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/RegistersNinja/httpfromtcp/internal/headers"
+)
+
+// DefaultBufferSize is how much of a body a BodyWriter holds back to compute
+// Content-Length before it switches to chunked framing.
+const DefaultBufferSize int = 8 * 1024
+
+var (
+	// ErrBodyTooLong is returned by BodyWriter.Write when the body would
+	// exceed the declared Content-Length; the excess is not sent.
+	ErrBodyTooLong = errors.New("error: body longer than declared Content-Length")
+	// ErrBodyTooShort is returned by BodyWriter.Close when fewer bytes than
+	// the declared Content-Length were written.
+	ErrBodyTooShort = errors.New("error: body shorter than declared Content-Length")
+)
+
+// BodyWriter sends one response through a Writer and takes care of its
+// framing:
+//
+//   - with a Content-Length in the headers, it checks that exactly that many
+//     bytes are written;
+//   - with "Transfer-Encoding: chunked", it sends every Write as a chunk;
+//   - with neither, it buffers the body and sets Content-Length on Close, or
+//     switches to chunked once the body outgrows the buffer or is flushed.
+//
+// Nothing is sent before the first Write that cannot be buffered, Flush or
+// Close, so the headers can be changed until then. Close must be called.
+type BodyWriter struct {
+	w        *Writer
+	status   StatusCode
+	header   *headers.Headers
+	trailers *headers.Headers
+	buf      []byte
+	size     int
+	declared int
+	written  int
+	chunked  bool
+	started  bool
+	closed   bool
+	err      error
+}
+
+func NewBodyWriter(w *Writer, status StatusCode, h *headers.Headers) *BodyWriter {
+	return NewBodyWriterSize(w, status, h, DefaultBufferSize)
+}
+
+// NewBodyWriterSize returns a BodyWriter that buffers up to size bytes.
+func NewBodyWriterSize(w *Writer, status StatusCode, h *headers.Headers, size int) *BodyWriter {
+	var (
+		bw    *BodyWriter
+		value string
+		ok    bool
+		err   error
+	)
+
+	if h == nil {
+		h = headers.NewHeaders()
+	}
+	bw = &BodyWriter{w: w, status: status, header: h, size: size, declared: noContentLength}
+	value, ok = h.Get(clString)
+	if ok {
+		bw.declared, err = strconv.Atoi(value)
+		if err != nil || bw.declared < 0 {
+			bw.err = fmt.Errorf("error: invalid Content-Length %q", value)
+		}
+	}
+	value, ok = h.Get(teString)
+	bw.chunked = ok && hasToken(value, chunkedString)
+	return bw
+}
+
+// Header returns the headers to be sent; changes after the headers went out
+// have no effect.
+func (bw *BodyWriter) Header() *headers.Headers {
+	return bw.header
+}
+
+// Trailers returns the trailer fields sent after a chunked body. They are
+// dropped when the body ends up with a Content-Length.
+func (bw *BodyWriter) Trailers() *headers.Headers {
+	if bw.trailers == nil {
+		bw.trailers = headers.NewHeaders()
+	}
+	return bw.trailers
+}
+
+// BytesWritten returns the number of body bytes accepted so far.
+func (bw *BodyWriter) BytesWritten() int {
+	return bw.written
+}
+
+// bodyless reports whether the response must not carry a body, in which case
+// written bytes are counted but not sent.
+func (bw *BodyWriter) bodyless() bool {
+	return bw.w.headRequest || !bodyAllowed(bw.status)
+}
+
+func (bw *BodyWriter) start() error {
+	var err error
+
+	bw.started = true
+	err = bw.w.WriteStatusLine(bw.status)
+	if err != nil {
+		return err
+	}
+	return bw.w.WriteHeaders(bw.header)
+}
+
+func (bw *BodyWriter) send(p []byte) error {
+	var err error
+
+	if bw.bodyless() || len(p) == 0 {
+		return nil
+	}
+	if bw.chunked {
+		_, err = bw.w.WriteChunkedBody(p)
+		return err
+	}
+	return bw.w.WriteBody(p)
+}
+
+// switchToChunked sends the headers with chunked framing, followed by
+// whatever was buffered.
+func (bw *BodyWriter) switchToChunked() error {
+	var (
+		buffered []byte
+		err      error
+	)
+
+	bw.chunked = true
+	bw.header.Set(teString, chunkedString)
+	err = bw.start()
+	if err != nil {
+		return err
+	}
+	buffered, bw.buf = bw.buf, nil
+	return bw.send(buffered)
+}
+
+func (bw *BodyWriter) Write(p []byte) (int, error) {
+	var (
+		n   int
+		err error
+	)
+
+	if bw.closed {
+		return 0, fmt.Errorf("error: write after Close")
+	}
+	if bw.err != nil {
+		return 0, bw.err
+	}
+
+	switch {
+	case bw.declared != noContentLength:
+		n = len(p)
+		if bw.written+n > bw.declared {
+			n = bw.declared - bw.written
+			bw.err = ErrBodyTooLong
+		}
+		if !bw.started {
+			err = bw.start()
+		}
+		if err == nil {
+			err = bw.send(p[:n])
+		}
+	case bw.chunked || bw.started:
+		if !bw.started {
+			err = bw.start()
+		}
+		n = len(p)
+		if err == nil {
+			err = bw.send(p)
+		}
+	case bw.bodyless():
+		// Nothing will be sent, so there is no need to hold on to the body
+		// to measure it.
+		n = len(p)
+	default:
+		bw.buf = append(bw.buf, p...)
+		n = len(p)
+		if len(bw.buf) > bw.size {
+			err = bw.switchToChunked()
+		}
+	}
+
+	bw.written += n
+	if err != nil {
+		bw.err = err
+		return n, err
+	}
+	return n, bw.err
+}
+
+// Flush sends the headers and everything buffered so far. Without a declared
+// Content-Length the body continues as chunked.
+func (bw *BodyWriter) Flush() error {
+	if bw.err != nil || bw.closed {
+		return bw.err
+	}
+	if !bw.started && bw.declared == noContentLength && !bw.chunked && !bw.bodyless() {
+		bw.err = bw.switchToChunked()
+		return bw.err
+	}
+	if !bw.started {
+		bw.err = bw.start()
+	}
+	return bw.err
+}
+
+// Close completes the response: it sets Content-Length for a buffered body,
+// ends a chunked one with the trailers, and reports a body shorter than its
+// declared length.
+func (bw *BodyWriter) Close() error {
+	var (
+		buffered []byte
+		err      error
+	)
+
+	if bw.closed {
+		return nil
+	}
+	bw.closed = true
+	if bw.err != nil && !bw.started {
+		return bw.err
+	}
+
+	if !bw.started {
+		if bw.declared == noContentLength && !bw.chunked && bodyAllowed(bw.status) {
+			bw.header.Set(clString, strconv.Itoa(bw.written))
+		}
+		err = bw.start()
+		if err != nil {
+			return err
+		}
+		buffered, bw.buf = bw.buf, nil
+		err = bw.send(buffered)
+		if err != nil {
+			return err
+		}
+	}
+
+	if bw.chunked && !bw.bodyless() {
+		if bw.trailers == nil {
+			bw.trailers = headers.NewHeaders()
+		}
+		err = bw.w.WriteTrailers(bw.trailers)
+		if err != nil {
+			return err
+		}
+	}
+	if bw.err != nil {
+		return bw.err
+	}
+	if bw.declared != noContentLength && bw.written < bw.declared {
+		return ErrBodyTooShort
+	}
+	return nil
+}
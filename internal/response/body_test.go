@@ -0,0 +1,165 @@
+package response
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/RegistersNinja/httpfromtcp/internal/headers"
+	"github.com/RegistersNinja/httpfromtcp/internal/request"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newRequest(t *testing.T, requestLine string) *request.Request {
+	req, err := request.RequestFromReader(strings.NewReader(requestLine + "\r\nHost: localhost\r\n\r\n"))
+	require.NoError(t, err)
+	return req
+}
+
+func TestBodyWriter(t *testing.T) {
+	t.Run("Buffered Body Gets Content-Length", func(t *testing.T) {
+		var buf bytes.Buffer
+		w := &Writer{Writer: &buf}
+		bw := NewBodyWriter(w, StatusOK, nil)
+		bw.Header().Set("Content-Type", "text/plain")
+		_, err := bw.Write([]byte("hello, "))
+		require.NoError(t, err)
+		assert.Empty(t, buf.String())
+		_, err = bw.Write([]byte("world"))
+		require.NoError(t, err)
+		require.NoError(t, bw.Close())
+		assert.Equal(t, "HTTP/1.1 200 OK\r\nContent-Type: text/plain\r\nContent-Length: 12\r\n\r\nhello, world", buf.String())
+		assert.False(t, w.ShouldClose())
+	})
+
+	t.Run("Empty Body", func(t *testing.T) {
+		var buf bytes.Buffer
+		w := &Writer{Writer: &buf}
+		require.NoError(t, NewBodyWriter(w, StatusOK, nil).Close())
+		assert.Equal(t, "HTTP/1.1 200 OK\r\nContent-Length: 0\r\n\r\n", buf.String())
+	})
+
+	t.Run("Switches To Chunked Past Threshold", func(t *testing.T) {
+		var buf bytes.Buffer
+		w := &Writer{Writer: &buf}
+		bw := NewBodyWriterSize(w, StatusOK, nil, 4)
+		_, err := bw.Write([]byte("abc"))
+		require.NoError(t, err)
+		assert.Empty(t, buf.String())
+		_, err = bw.Write([]byte("de"))
+		require.NoError(t, err)
+		_, err = bw.Write([]byte("fgh"))
+		require.NoError(t, err)
+		bw.Trailers().Set("X-Count", "8")
+		require.NoError(t, bw.Close())
+		assert.Equal(t, "HTTP/1.1 200 OK\r\nTransfer-Encoding: chunked\r\n\r\n5\r\nabcde\r\n3\r\nfgh\r\n0\r\nX-Count: 8\r\n\r\n", buf.String())
+		assert.Equal(t, 8, bw.BytesWritten())
+		assert.False(t, w.ShouldClose())
+	})
+
+	t.Run("Flush Starts Chunked", func(t *testing.T) {
+		var buf bytes.Buffer
+		w := &Writer{Writer: &buf}
+		bw := NewBodyWriter(w, StatusOK, nil)
+		_, _ = bw.Write([]byte("ab"))
+		require.NoError(t, bw.Flush())
+		assert.Equal(t, "HTTP/1.1 200 OK\r\nTransfer-Encoding: chunked\r\n\r\n2\r\nab\r\n", buf.String())
+		require.NoError(t, bw.Close())
+		assert.True(t, strings.HasSuffix(buf.String(), "0\r\n\r\n"))
+	})
+
+	t.Run("Declared Length Checked", func(t *testing.T) {
+		var buf bytes.Buffer
+		w := &Writer{Writer: &buf}
+		h := headers.NewHeaders()
+		h.Set("Content-Length", "5")
+		bw := NewBodyWriter(w, StatusOK, h)
+		n, err := bw.Write([]byte("abc"))
+		require.NoError(t, err)
+		assert.Equal(t, 3, n)
+		assert.Equal(t, "HTTP/1.1 200 OK\r\nContent-Length: 5\r\n\r\nabc", buf.String())
+		n, err = bw.Write([]byte("defg"))
+		assert.ErrorIs(t, err, ErrBodyTooLong)
+		assert.Equal(t, 2, n)
+		assert.Equal(t, "HTTP/1.1 200 OK\r\nContent-Length: 5\r\n\r\nabcde", buf.String())
+		assert.ErrorIs(t, bw.Close(), ErrBodyTooLong)
+	})
+
+	t.Run("Short Body Reported", func(t *testing.T) {
+		var buf bytes.Buffer
+		w := &Writer{Writer: &buf}
+		h := headers.NewHeaders()
+		h.Set("Content-Length", "5")
+		bw := NewBodyWriter(w, StatusOK, h)
+		_, err := bw.Write([]byte("abc"))
+		require.NoError(t, err)
+		assert.ErrorIs(t, bw.Close(), ErrBodyTooShort)
+		assert.True(t, w.ShouldClose())
+	})
+
+	t.Run("Invalid Declared Length", func(t *testing.T) {
+		var buf bytes.Buffer
+		w := &Writer{Writer: &buf}
+		h := headers.NewHeaders()
+		h.Set("Content-Length", "five")
+		bw := NewBodyWriter(w, StatusOK, h)
+		_, err := bw.Write([]byte("abc"))
+		assert.Error(t, err)
+		assert.Error(t, bw.Close())
+		assert.Empty(t, buf.String())
+	})
+
+	t.Run("Explicit Chunked", func(t *testing.T) {
+		var buf bytes.Buffer
+		w := &Writer{Writer: &buf}
+		h := headers.NewHeaders()
+		h.Set("Transfer-Encoding", "chunked")
+		bw := NewBodyWriter(w, StatusOK, h)
+		_, err := bw.Write([]byte("abc"))
+		require.NoError(t, err)
+		assert.Equal(t, "HTTP/1.1 200 OK\r\nTransfer-Encoding: chunked\r\n\r\n3\r\nabc\r\n", buf.String())
+		require.NoError(t, bw.Close())
+	})
+
+	t.Run("HEAD Measures Without Sending", func(t *testing.T) {
+		var buf bytes.Buffer
+		w := NewWriter(&buf, newRequest(t, "HEAD / HTTP/1.1"))
+		bw := NewBodyWriterSize(w, StatusOK, nil, 4)
+		_, err := bw.Write([]byte("hello, world"))
+		require.NoError(t, err)
+		require.NoError(t, bw.Close())
+		assert.Equal(t, "HTTP/1.1 200 OK\r\nContent-Length: 12\r\n\r\n", buf.String())
+		assert.False(t, w.ShouldClose())
+	})
+
+	t.Run("No Content", func(t *testing.T) {
+		var buf bytes.Buffer
+		w := &Writer{Writer: &buf}
+		bw := NewBodyWriter(w, StatusNoContent, nil)
+		_, err := bw.Write([]byte("ignored"))
+		require.NoError(t, err)
+		require.NoError(t, bw.Close())
+		assert.Equal(t, "HTTP/1.1 204 No Content\r\n\r\n", buf.String())
+	})
+
+	t.Run("HTTP/1.0 Streams Until Close", func(t *testing.T) {
+		var buf bytes.Buffer
+		w := NewWriter(&buf, newRequest(t, "GET / HTTP/1.0"))
+		bw := NewBodyWriterSize(w, StatusOK, nil, 2)
+		_, err := bw.Write([]byte("abc"))
+		require.NoError(t, err)
+		require.NoError(t, bw.Close())
+		assert.Equal(t, "HTTP/1.0 200 OK\r\nConnection: close\r\n\r\nabc", buf.String())
+		assert.True(t, w.ShouldClose())
+	})
+
+	t.Run("Write After Close", func(t *testing.T) {
+		w := &Writer{Writer: &bytes.Buffer{}}
+		bw := NewBodyWriter(w, StatusOK, nil)
+		require.NoError(t, bw.Close())
+		_, err := bw.Write([]byte("x"))
+		assert.Error(t, err)
+	})
+}
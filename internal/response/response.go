@@ -4,41 +4,261 @@ import (
 	"fmt"
 	"io"
 	"strconv"
+	"strings"
 
 	"github.com/RegistersNinja/httpfromtcp/internal/headers"
+	"github.com/RegistersNinja/httpfromtcp/internal/request"
 )
 
-type StatusCode int
 type writerState int
 
+// FieldMode decides what WriteHeaders and WriteTrailers do with a field that
+// would corrupt the message, such as a value holding CR or LF that would let
+// a copied user value inject headers or split the response.
+type FieldMode int
+
+const (
+	// FieldReject fails the write without sending anything.
+	FieldReject FieldMode = iota
+	// FieldSanitize drops fields with invalid names and replaces control
+	// characters in values with spaces.
+	FieldSanitize
+)
+
 type Writer struct {
 	Writer      io.Writer
 	writerState writerState
+
+	httpVersion    string
+	headRequest    bool
+	closeAfter     bool
+	announcedClose bool
+	statusCode     StatusCode
+	contentLength  int
+	chunked        bool
+	unframedChunks bool
+	bodyBytes      int
+	writeErr       error
+	keepCase       bool
+	fieldMode      FieldMode
 }
 
 const (
-	StatusOK                  StatusCode  = 200
-	StatusBadRequest          StatusCode  = 400
-	StatusInternalServerError StatusCode  = 500
-	httpVerString             string      = "HTTP/1.1"
-	spaceString               string      = " "
-	lineOKString              string      = "200 OK"
-	lineBRString              string      = "400 Bad Request"
-	lineSEString              string      = "500 Internal Server Error"
-	clString                  string      = "Content-Length"
-	conString                 string      = "Connection"
-	conValString              string      = "close"
-	ctString                  string      = "Content-Type"
-	ctValString               string      = "text/plain"
-	crlfString                string      = "\r\n"
-	statusLineState           writerState = 0
-	headersState              writerState = 1
-	bodyState                 writerState = 2
-	trailersState             writerState = 3
-	chunkDone                 byte        = byte('0')
+	httpVerString      string      = "HTTP/1.1"
+	httpVer10String    string      = "HTTP/1.0"
+	conKeepAliveString string      = "keep-alive"
+	trailerString      string      = "Trailer"
+	spaceString        string      = " "
+	clString           string      = "Content-Length"
+	conString          string      = "Connection"
+	conValString       string      = "close"
+	teString           string      = "Transfer-Encoding"
+	chunkedString      string      = "chunked"
+	headMethod         string      = "HEAD"
+	listSeparator      string      = ","
+	noContentLength    int         = -1
+	ctString           string      = "Content-Type"
+	ctValString        string      = "text/plain"
+	crlfString         string      = "\r\n"
+	statusLineState    writerState = 0
+	headersState       writerState = 1
+	bodyState          writerState = 2
+	trailersState      writerState = 3
+	chunkDone          byte        = byte('0')
 )
 
+// NewWriter returns a Writer answering req, which lets it tell whether the
+// response is allowed to leave its body out and which HTTP version the client
+// speaks. A nil req is answered as HTTP/1.1.
+func NewWriter(w io.Writer, req *request.Request) *Writer {
+	var rpWriter *Writer
+
+	rpWriter = &Writer{Writer: w}
+	if req != nil {
+		rpWriter.headRequest = req.RequestLine.Method == headMethod
+		rpWriter.httpVersion = req.RequestLine.HttpVersion
+	}
+	return rpWriter
+}
+
+func (w *Writer) isHTTP10() bool {
+	return w.httpVersion == request.HTTPVersion10
+}
+
+// selfDelimited reports whether the client can find the end of the response
+// without the connection being closed.
+func (w *Writer) selfDelimited() bool {
+	return w.chunked || w.contentLength != noContentLength || w.bodyless()
+}
+
+// CloseAfterResponse marks the connection to be closed once this response is
+// written; WriteHeaders then announces it with "Connection: close".
+func (w *Writer) CloseAfterResponse() {
+	w.closeAfter = true
+}
+
+// KeepHeaderCase makes WriteHeaders and WriteTrailers send field names as the
+// caller wrote them instead of in canonical form.
+func (w *Writer) KeepHeaderCase() {
+	w.keepCase = true
+}
+
+// SetFieldMode chooses how invalid header and trailer fields are handled. The
+// default is FieldReject.
+func (w *Writer) SetFieldMode(mode FieldMode) {
+	w.fieldMode = mode
+}
+
+// Written reports whether anything of the response has been sent yet.
+func (w *Writer) Written() bool {
+	return w.writerState != statusLineState
+}
+
+// ShouldClose reports whether the connection cannot carry another response:
+// either side asked to close it, or the message written so far does not end
+// where the client would expect it to.
+func (w *Writer) ShouldClose() bool {
+	if w.closeAfter || w.writeErr != nil {
+		return true
+	}
+	if w.writerState == statusLineState || w.writerState == headersState {
+		return true
+	}
+	if w.chunked || w.unframedChunks {
+		return w.writerState != trailersState
+	}
+	if w.bodyless() {
+		return false
+	}
+	if w.contentLength == noContentLength {
+		return true
+	}
+	return w.bodyBytes != w.contentLength
+}
+
+// bodyless reports whether the response must not carry a body: it answers
+// HEAD or its status rules a body out.
+func (w *Writer) bodyless() bool {
+	return w.headRequest || !bodyAllowed(w.statusCode)
+}
+
+func bodyAllowed(statusCode StatusCode) bool {
+	return statusCode >= 200 && statusCode != 204 && statusCode != 304
+}
+
+func hasToken(value string, token string) bool {
+	var part string
+
+	for _, part = range strings.Split(value, listSeparator) {
+		if strings.EqualFold(strings.TrimSpace(part), token) {
+			return true
+		}
+	}
+	return false
+}
+
+// inspectHeaders records the framing and connection options of the response
+// headers. Names are matched case-insensitively since callers may use any
+// casing.
+func (w *Writer) inspectHeaders(h *headers.Headers) {
+	var (
+		field headers.Field
+		err   error
+	)
+
+	w.contentLength = noContentLength
+	for _, field = range h.Fields() {
+		switch {
+		case strings.EqualFold(field.Name, clString):
+			w.contentLength, err = strconv.Atoi(field.Value)
+			if err != nil {
+				w.contentLength = noContentLength
+			}
+		case strings.EqualFold(field.Name, teString):
+			// chunked has to be the final coding, so the last field decides.
+			w.chunked = hasToken(field.Value, chunkedString)
+		case strings.EqualFold(field.Name, conString):
+			if hasToken(field.Value, conValString) {
+				w.closeAfter = true
+				w.announcedClose = true
+			}
+		}
+	}
+}
+
+// skipHeader drops the chunked framing headers from a response to an
+// HTTP/1.0 client, which does not understand them.
+func (w *Writer) skipHeader(key string) bool {
+	return w.unframedChunks && (strings.EqualFold(key, teString) || strings.EqualFold(key, trailerString))
+}
+
+// checkFields validates the names and values of h and returns a copy the
+// writer may adjust, repaired in FieldSanitize mode. h itself is never
+// modified.
+func (w *Writer) checkFields(h *headers.Headers) (*headers.Headers, error) {
+	var (
+		field     headers.Field
+		sanitized *headers.Headers
+	)
+
+	sanitized = headers.NewHeaders()
+	for _, field = range h.Fields() {
+		if !headers.ValidFieldName(field.Name) {
+			if w.fieldMode == FieldReject {
+				return nil, fmt.Errorf("error: invalid field name %q", field.Name)
+			}
+			continue
+		}
+		if !headers.ValidFieldValue(field.Value) {
+			if w.fieldMode == FieldReject {
+				return nil, fmt.Errorf("error: invalid value for field %s: %q", field.Name, field.Value)
+			}
+			field.Value = headers.SanitizeFieldValue(field.Value)
+		}
+		sanitized.Add(field.Name, field.Value)
+	}
+	return sanitized, nil
+}
+
+// appendFields serializes h in insertion order with repeated fields combined,
+// so a field the caller set twice, in whatever casing, goes out once.
+func (w *Writer) appendFields(dst []byte, h *headers.Headers) []byte {
+	var (
+		field headers.Field
+		name  string
+	)
+
+	for _, field = range h.Combined() {
+		if w.skipHeader(field.Name) {
+			continue
+		}
+		name = field.Name
+		if !w.keepCase {
+			name = headers.CanonicalName(name)
+		}
+		dst = fmt.Appendf(dst, "%s: %s"+crlfString, name, field.Value)
+	}
+	return dst
+}
+
+func (w *Writer) write(p []byte) error {
+	var err error
+
+	_, err = w.Writer.Write(p)
+	if err != nil && w.writeErr == nil {
+		w.writeErr = err
+	}
+	return err
+}
+
 func (w *Writer) WriteStatusLine(statusCode StatusCode) error {
+	return w.WriteStatusLineReason(statusCode, StatusText(statusCode))
+}
+
+// WriteStatusLineReason writes the status line with a custom reason phrase.
+// Any three-digit code is accepted; the reason may be empty but must not hold
+// control characters.
+func (w *Writer) WriteStatusLineReason(statusCode StatusCode, reason string) error {
 	switch w.writerState {
 	case statusLineState:
 		break
@@ -57,33 +277,36 @@ func (w *Writer) WriteStatusLine(statusCode StatusCode) error {
 		statusLine string
 	)
 
-	statusLine = httpVerString + spaceString
-	switch statusCode {
-	case StatusOK:
-		statusLine += lineOKString
-	case StatusBadRequest:
-		statusLine += lineBRString
-	case StatusInternalServerError:
-		statusLine += lineSEString
+	if statusCode < minStatusCode || statusCode > maxStatusCode {
+		return fmt.Errorf("error: status code must have three digits, got %d", statusCode)
 	}
+	if !isValidReason(reason) {
+		return fmt.Errorf("error: invalid reason phrase %q", reason)
+	}
+
+	statusLine = httpVerString
+	if w.isHTTP10() {
+		statusLine = httpVer10String
+	}
+	statusLine += spaceString + strconv.Itoa(int(statusCode)) + spaceString + reason
 	statusLine += crlfString
 
-	_, err = w.Writer.Write([]byte(statusLine))
+	err = w.write([]byte(statusLine))
+	w.statusCode = statusCode
 	w.writerState = headersState
 	return err
 }
 
-func GetDefaultHeaders(contentLen int) headers.Headers {
-	var h headers.Headers = headers.NewHeaders()
+func GetDefaultHeaders(contentLen int) *headers.Headers {
+	var h *headers.Headers = headers.NewHeaders()
 
-	h[clString] = strconv.Itoa(contentLen)
-	h[conString] = conValString
-	h[ctString] = ctValString
+	h.Set(clString, strconv.Itoa(contentLen))
+	h.Set(ctString, ctValString)
 
 	return h
 }
 
-func (w *Writer) WriteHeaders(h headers.Headers) error {
+func (w *Writer) WriteHeaders(h *headers.Headers) error {
 	switch w.writerState {
 	case statusLineState:
 		return fmt.Errorf("incorrect order of response: first print status line")
@@ -97,18 +320,36 @@ func (w *Writer) WriteHeaders(h headers.Headers) error {
 		return fmt.Errorf("incorrect order of response: unknown writer state")
 	}
 	var (
-		key            string
-		value          string
 		headersToWrite []byte
 		err            error
 	)
 
-	for key, value = range h {
-		headersToWrite = fmt.Appendf(headersToWrite, "%s: %s\r\n", key, value)
+	h, err = w.checkFields(h)
+	if err != nil {
+		return err
+	}
+	w.inspectHeaders(h)
+	if w.chunked && w.isHTTP10() {
+		// HTTP/1.0 has no chunked coding: send the chunks' payload as is and
+		// mark the end of the body by closing the connection.
+		w.chunked = false
+		w.unframedChunks = true
 	}
+	if !w.selfDelimited() {
+		w.closeAfter = true
+	}
+
+	switch {
+	case w.closeAfter && !w.announcedClose:
+		h.Set(conString, conValString)
+	case !w.closeAfter && w.isHTTP10():
+		// A persistent HTTP/1.0 connection has to be confirmed explicitly.
+		h.Set(conString, conKeepAliveString)
+	}
+	headersToWrite = w.appendFields(headersToWrite, h)
 
 	headersToWrite = fmt.Append(headersToWrite, crlfString)
-	_, err = w.Writer.Write(headersToWrite)
+	err = w.write(headersToWrite)
 	w.writerState = bodyState
 	return err
 }
@@ -126,7 +367,14 @@ func (w *Writer) WriteBody(body []byte) (err error) {
 	default:
 		return fmt.Errorf("incorrect order of response: unknown writer state")
 	}
-	_, err = w.Writer.Write(body)
+	if w.bodyless() {
+		// The framing headers still describe the body, but none is sent.
+		return nil
+	}
+	err = w.write(body)
+	if !w.chunked {
+		w.bodyBytes += len(body)
+	}
 
 	return err
 }
@@ -153,6 +401,13 @@ func (w *Writer) WriteChunkedBody(p []byte) (int, error) {
 	)
 
 	bodyLength = len(p)
+	if w.bodyless() {
+		return bodyLength, nil
+	}
+	if w.unframedChunks {
+		err = w.WriteBody(p)
+		return bodyLength, err
+	}
 	bytesHex = strconv.FormatInt(int64(bodyLength), 16)
 
 	bodyToWrite = append(bodyToWrite, []byte(bytesHex)...)
@@ -174,7 +429,7 @@ func (w *Writer) writeChunkedBodyDone() error {
 	bodyToWrite = append(bodyToWrite, chunkDone)
 	bodyToWrite = append(bodyToWrite, []byte(crlfString)...)
 
-	_, err = w.Writer.Write(bodyToWrite)
+	err = w.write(bodyToWrite)
 	if err != nil {
 		return err
 	}
@@ -183,7 +438,7 @@ func (w *Writer) writeChunkedBodyDone() error {
 	return nil
 }
 
-func (w *Writer) WriteTrailers(t headers.Headers) error {
+func (w *Writer) WriteTrailers(t *headers.Headers) error {
 	switch w.writerState {
 	case statusLineState:
 		return fmt.Errorf("incorrect order of response: first print status line")
@@ -198,22 +453,29 @@ func (w *Writer) WriteTrailers(t headers.Headers) error {
 	}
 
 	var (
-		key             string
-		value           string
 		trailersToWrite []byte
 		err             error
 	)
 
-	err = w.writeChunkedBodyDone()
+	t, err = w.checkFields(t)
 	if err != nil {
 		return err
 	}
 
-	for key, value = range t {
-		trailersToWrite = fmt.Appendf(trailersToWrite, "%s: %s"+crlfString, key, value)
+	if w.unframedChunks || w.bodyless() {
+		// Trailers cannot be sent without chunked framing, nor after a body
+		// that is left out.
+		w.writerState = trailersState
+		return nil
+	}
+
+	err = w.writeChunkedBodyDone()
+	if err != nil {
+		return err
 	}
 
+	trailersToWrite = w.appendFields(trailersToWrite, t)
+
 	trailersToWrite = fmt.Append(trailersToWrite, crlfString)
-	_, err = w.Writer.Write(trailersToWrite)
-	return err
+	return w.write(trailersToWrite)
 }
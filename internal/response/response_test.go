@@ -0,0 +1,182 @@
+package response
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/RegistersNinja/httpfromtcp/internal/headers"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteStatusLine(t *testing.T) {
+	tests := []struct {
+		code StatusCode
+		want string
+	}{
+		{StatusOK, "HTTP/1.1 200 OK\r\n"},
+		{StatusNotFound, "HTTP/1.1 404 Not Found\r\n"},
+		{StatusTooManyRequests, "HTTP/1.1 429 Too Many Requests\r\n"},
+		{StatusNetworkAuthenticationRequired, "HTTP/1.1 511 Network Authentication Required\r\n"},
+		{299, "HTTP/1.1 299 \r\n"},
+	}
+	for _, tc := range tests {
+		var buf bytes.Buffer
+		w := &Writer{Writer: &buf}
+		require.NoError(t, w.WriteStatusLine(tc.code))
+		assert.Equal(t, tc.want, buf.String())
+	}
+
+	t.Run("Custom Reason", func(t *testing.T) {
+		var buf bytes.Buffer
+		w := &Writer{Writer: &buf}
+		require.NoError(t, w.WriteStatusLineReason(StatusOK, "Totally Fine"))
+		assert.Equal(t, "HTTP/1.1 200 Totally Fine\r\n", buf.String())
+	})
+
+	t.Run("Invalid Codes And Reasons", func(t *testing.T) {
+		for _, code := range []StatusCode{0, 99, 1000, -200} {
+			w := &Writer{Writer: &bytes.Buffer{}}
+			assert.Error(t, w.WriteStatusLine(code), code)
+		}
+		w := &Writer{Writer: &bytes.Buffer{}}
+		assert.Error(t, w.WriteStatusLineReason(StatusOK, "OK\r\nX-Injected: 1"))
+	})
+}
+
+func TestWriteHeadersMultiValue(t *testing.T) {
+	var buf bytes.Buffer
+	w := &Writer{Writer: &buf}
+	h := headers.NewHeaders()
+	h.Add("Content-Length", "0")
+	h.Add("Set-Cookie", "a=1")
+	h.Add("Set-Cookie", "b=2")
+	require.NoError(t, w.WriteStatusLine(StatusOK))
+	require.NoError(t, w.WriteHeaders(h))
+	assert.Equal(t, "HTTP/1.1 200 OK\r\nContent-Length: 0\r\nSet-Cookie: a=1\r\nSet-Cookie: b=2\r\n\r\n", buf.String())
+}
+
+func TestWriteHeadersCanonical(t *testing.T) {
+	t.Run("Canonical Casing And Stable Order", func(t *testing.T) {
+		for i := 0; i < 5; i++ {
+			var buf bytes.Buffer
+			w := &Writer{Writer: &buf}
+			h := GetDefaultHeaders(0)
+			h.Set("content-length", "0")
+			h.Add("x-request-id", "abc")
+			h.Add("X-REQUEST-ID", "abc")
+			require.NoError(t, w.WriteStatusLine(StatusOK))
+			require.NoError(t, w.WriteHeaders(h))
+			assert.Equal(t, "HTTP/1.1 200 OK\r\nContent-Length: 0\r\nContent-Type: text/plain\r\nX-Request-Id: abc\r\n\r\n", buf.String())
+		}
+	})
+
+	t.Run("Keep Header Case", func(t *testing.T) {
+		var buf bytes.Buffer
+		w := &Writer{Writer: &buf}
+		w.KeepHeaderCase()
+		h := headers.NewHeaders()
+		h.Add("content-length", "0")
+		h.Add("X-API-Key", "k")
+		require.NoError(t, w.WriteStatusLine(StatusOK))
+		require.NoError(t, w.WriteHeaders(h))
+		assert.Equal(t, "HTTP/1.1 200 OK\r\ncontent-length: 0\r\nX-API-Key: k\r\n\r\n", buf.String())
+	})
+
+	t.Run("Connection Not Duplicated", func(t *testing.T) {
+		var buf bytes.Buffer
+		w := &Writer{Writer: &buf}
+		w.CloseAfterResponse()
+		h := headers.NewHeaders()
+		h.Add("Content-Length", "0")
+		h.Add("connection", "keep-alive")
+		require.NoError(t, w.WriteStatusLine(StatusOK))
+		require.NoError(t, w.WriteHeaders(h))
+		assert.Equal(t, "HTTP/1.1 200 OK\r\nContent-Length: 0\r\nConnection: close\r\n\r\n", buf.String())
+		v, _ := h.Get("Connection")
+		assert.Equal(t, "keep-alive", v)
+	})
+
+	t.Run("Trailers", func(t *testing.T) {
+		var buf bytes.Buffer
+		w := &Writer{Writer: &buf}
+		h := headers.NewHeaders()
+		h.Add("Transfer-Encoding", "chunked")
+		tr := headers.NewHeaders()
+		tr.Add("x-checksum", "1")
+		tr.Add("X-Checksum", "1")
+		require.NoError(t, w.WriteStatusLine(StatusOK))
+		require.NoError(t, w.WriteHeaders(h))
+		require.NoError(t, w.WriteTrailers(tr))
+		assert.Equal(t, "HTTP/1.1 200 OK\r\nTransfer-Encoding: chunked\r\n\r\n0\r\nX-Checksum: 1\r\n\r\n", buf.String())
+	})
+}
+
+func TestWriteHeadersInjection(t *testing.T) {
+	bad := []struct {
+		name  string
+		value string
+	}{
+		{"X-Evil", "a\r\nSet-Cookie: admin=1"},
+		{"X-Evil", "a\nb"},
+		{"X-Evil", "a\x00b"},
+		{"X-Evil", "a\x7fb"},
+		{"X-Evil", " padded"},
+		{"X Evil", "a"},
+		{"X-Evil\r\nInjected", "a"},
+		{"", "a"},
+	}
+
+	t.Run("Reject", func(t *testing.T) {
+		for _, tc := range bad {
+			var buf bytes.Buffer
+			w := &Writer{Writer: &buf}
+			require.NoError(t, w.WriteStatusLine(StatusOK))
+			buf.Reset()
+			h := headers.NewHeaders()
+			h.Add("Content-Length", "0")
+			h.Add(tc.name, tc.value)
+			assert.Error(t, w.WriteHeaders(h), "%q: %q", tc.name, tc.value)
+			assert.Empty(t, buf.String())
+		}
+	})
+
+	t.Run("Reject Trailers", func(t *testing.T) {
+		var buf bytes.Buffer
+		w := &Writer{Writer: &buf}
+		h := headers.NewHeaders()
+		h.Add("Transfer-Encoding", "chunked")
+		require.NoError(t, w.WriteStatusLine(StatusOK))
+		require.NoError(t, w.WriteHeaders(h))
+		buf.Reset()
+		tr := headers.NewHeaders()
+		tr.Add("X-Checksum", "1\r\n\r\nHTTP/1.1 200 OK")
+		assert.Error(t, w.WriteTrailers(tr))
+		assert.Empty(t, buf.String())
+	})
+
+	t.Run("Sanitize", func(t *testing.T) {
+		var buf bytes.Buffer
+		w := &Writer{Writer: &buf}
+		w.SetFieldMode(FieldSanitize)
+		h := headers.NewHeaders()
+		h.Add("Content-Length", "0")
+		h.Add("Content-Type", "text/html\r\nSet-Cookie: admin=1")
+		h.Add("X Evil", "dropped")
+		require.NoError(t, w.WriteStatusLine(StatusOK))
+		require.NoError(t, w.WriteHeaders(h))
+		assert.Equal(t, "HTTP/1.1 200 OK\r\nContent-Length: 0\r\nContent-Type: text/html  Set-Cookie: admin=1\r\n\r\n", buf.String())
+	})
+
+	t.Run("Tabs And Obs-Text Allowed", func(t *testing.T) {
+		var buf bytes.Buffer
+		w := &Writer{Writer: &buf}
+		h := headers.NewHeaders()
+		h.Add("Content-Length", "0")
+		h.Add("X-Note", "a\tb \xe9")
+		require.NoError(t, w.WriteStatusLine(StatusOK))
+		require.NoError(t, w.WriteHeaders(h))
+		assert.Contains(t, buf.String(), "X-Note: a\tb \xe9\r\n")
+	})
+}
@@ -0,0 +1,114 @@
+package response
+
+import (
+	"io"
+
+	"github.com/RegistersNinja/httpfromtcp/internal/headers"
+)
+
+const readFromBufferSize int = 32 * 1024
+
+// ResponseWriter is a net/http-style facade over Writer: headers are collected
+// through Header, the status is set with WriteHeader, and the first Write
+// commits both, with an implicit 200 if WriteHeader was not called. Framing is
+// left to a BodyWriter, so Content-Length is computed for small bodies and
+// larger ones are chunked.
+//
+// Close must be called once the handler is done; server.ResponseHandler does
+// that.
+type ResponseWriter struct {
+	w        *Writer
+	header   *headers.Headers
+	trailers *headers.Headers
+	body     *BodyWriter
+}
+
+func NewResponseWriter(w *Writer) *ResponseWriter {
+	return &ResponseWriter{w: w, header: headers.NewHeaders(), trailers: headers.NewHeaders()}
+}
+
+// Header returns the headers to be sent. Content-Length and
+// Transfer-Encoding have to be set before WriteHeader or the first Write, and
+// nothing can be changed once the headers went out.
+func (rw *ResponseWriter) Header() *headers.Headers {
+	return rw.header
+}
+
+// Trailers returns the trailer fields sent at the end of a chunked body. They
+// can be filled in until Close.
+func (rw *ResponseWriter) Trailers() *headers.Headers {
+	return rw.trailers
+}
+
+// SetFieldMode chooses how invalid header and trailer fields are handled;
+// see Writer.SetFieldMode.
+func (rw *ResponseWriter) SetFieldMode(mode FieldMode) {
+	rw.w.SetFieldMode(mode)
+}
+
+// WriteHeader sets the status of the response. Only the first call counts.
+func (rw *ResponseWriter) WriteHeader(code StatusCode) {
+	if rw.body != nil {
+		return
+	}
+	rw.body = NewBodyWriter(rw.w, code, rw.header)
+	rw.body.trailers = rw.trailers
+}
+
+// Status returns the status set so far, or 0 if none was.
+func (rw *ResponseWriter) Status() StatusCode {
+	if rw.body == nil {
+		return 0
+	}
+	return rw.body.status
+}
+
+func (rw *ResponseWriter) Write(p []byte) (int, error) {
+	rw.WriteHeader(StatusOK)
+	return rw.body.Write(p)
+}
+
+// ReadFrom copies r into the body until EOF, so io.Copy to a ResponseWriter
+// needs no intermediate buffer of the caller's.
+func (rw *ResponseWriter) ReadFrom(r io.Reader) (int64, error) {
+	var (
+		buf     []byte
+		n       int
+		total   int64
+		readErr error
+		err     error
+	)
+
+	rw.WriteHeader(StatusOK)
+	buf = make([]byte, readFromBufferSize)
+	for {
+		n, readErr = r.Read(buf)
+		if n > 0 {
+			n, err = rw.body.Write(buf[:n])
+			total += int64(n)
+			if err != nil {
+				return total, err
+			}
+		}
+		if readErr == io.EOF {
+			return total, nil
+		}
+		if readErr != nil {
+			return total, readErr
+		}
+	}
+}
+
+// Flush sends the headers and any buffered body, so the client sees the
+// response start; the body continues chunked unless Content-Length was set.
+func (rw *ResponseWriter) Flush() error {
+	rw.WriteHeader(StatusOK)
+	return rw.body.Flush()
+}
+
+// Close completes the response, sending an empty 200 if nothing else was
+// written.
+func (rw *ResponseWriter) Close() error {
+	rw.WriteHeader(StatusOK)
+	return rw.body.Close()
+}
@@ -0,0 +1,89 @@
+package response
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResponseWriter(t *testing.T) {
+	t.Run("Implicit 200", func(t *testing.T) {
+		var buf bytes.Buffer
+		rw := NewResponseWriter(&Writer{Writer: &buf})
+		rw.Header().Set("Content-Type", "text/plain")
+		fmt.Fprintf(rw, "hello %s", "world")
+		assert.Equal(t, StatusOK, rw.Status())
+		require.NoError(t, rw.Close())
+		assert.Equal(t, "HTTP/1.1 200 OK\r\nContent-Type: text/plain\r\nContent-Length: 11\r\n\r\nhello world", buf.String())
+	})
+
+	t.Run("First WriteHeader Wins", func(t *testing.T) {
+		var buf bytes.Buffer
+		rw := NewResponseWriter(&Writer{Writer: &buf})
+		assert.Equal(t, StatusCode(0), rw.Status())
+		rw.WriteHeader(StatusCreated)
+		rw.WriteHeader(StatusInternalServerError)
+		require.NoError(t, json.NewEncoder(rw).Encode(map[string]int{"id": 7}))
+		require.NoError(t, rw.Close())
+		assert.Equal(t, "HTTP/1.1 201 Created\r\nContent-Length: 9\r\n\r\n{\"id\":7}\n", buf.String())
+	})
+
+	t.Run("Close Without Writes", func(t *testing.T) {
+		var buf bytes.Buffer
+		rw := NewResponseWriter(&Writer{Writer: &buf})
+		require.NoError(t, rw.Close())
+		assert.Equal(t, "HTTP/1.1 200 OK\r\nContent-Length: 0\r\n\r\n", buf.String())
+	})
+
+	t.Run("Copy Large Body", func(t *testing.T) {
+		var buf bytes.Buffer
+		rw := NewResponseWriter(&Writer{Writer: &buf})
+		var _ io.ReaderFrom = rw
+		body := strings.Repeat("x", DefaultBufferSize+1)
+		n, err := io.Copy(rw, strings.NewReader(body))
+		require.NoError(t, err)
+		assert.Equal(t, int64(len(body)), n)
+		rw.Trailers().Set("X-Length", fmt.Sprint(n))
+		require.NoError(t, rw.Close())
+		assert.True(t, strings.HasPrefix(buf.String(), "HTTP/1.1 200 OK\r\nTransfer-Encoding: chunked\r\n\r\n"))
+		assert.True(t, strings.HasSuffix(buf.String(), "\r\n0\r\nX-Length: 8193\r\n\r\n"))
+	})
+
+	t.Run("Copy With Declared Length", func(t *testing.T) {
+		var buf bytes.Buffer
+		rw := NewResponseWriter(&Writer{Writer: &buf})
+		rw.Header().Set("Content-Length", "3")
+		n, err := rw.ReadFrom(strings.NewReader("abcdef"))
+		assert.ErrorIs(t, err, ErrBodyTooLong)
+		assert.Equal(t, int64(3), n)
+		assert.Equal(t, "HTTP/1.1 200 OK\r\nContent-Length: 3\r\n\r\nabc", buf.String())
+	})
+
+	t.Run("Flush", func(t *testing.T) {
+		var buf bytes.Buffer
+		rw := NewResponseWriter(&Writer{Writer: &buf})
+		rw.Header().Set("Content-Type", "text/event-stream")
+		_, _ = rw.Write([]byte("data: 1\n\n"))
+		assert.Empty(t, buf.String())
+		require.NoError(t, rw.Flush())
+		assert.Equal(t, "HTTP/1.1 200 OK\r\nContent-Type: text/event-stream\r\nTransfer-Encoding: chunked\r\n\r\n9\r\ndata: 1\n\n\r\n", buf.String())
+		require.NoError(t, rw.Close())
+	})
+
+	t.Run("Trailers Set Before WriteHeader", func(t *testing.T) {
+		var buf bytes.Buffer
+		rw := NewResponseWriter(&Writer{Writer: &buf})
+		rw.Header().Set("Transfer-Encoding", "chunked")
+		rw.Trailers().Set("X-Done", "yes")
+		rw.WriteHeader(StatusAccepted)
+		_, _ = rw.Write([]byte("ok"))
+		require.NoError(t, rw.Close())
+		assert.Equal(t, "HTTP/1.1 202 Accepted\r\nTransfer-Encoding: chunked\r\n\r\n2\r\nok\r\n0\r\nX-Done: yes\r\n\r\n", buf.String())
+	})
+}
@@ -0,0 +1,120 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"time"
+
+	"github.com/RegistersNinja/httpfromtcp/internal/request"
+)
+
+// ErrClientClosed is the cause of a request context cancelled because the
+// client closed its side of the connection.
+var ErrClientClosed = errors.New("error: client closed the connection")
+
+// contextKey identifies the values the server stores in request contexts.
+type contextKey int
+
+const (
+	localAddrKey contextKey = iota
+	remoteAddrKey
+	shutdownKey
+)
+
+// LocalAddr returns the address the request arrived on, or nil if ctx does not
+// belong to a request served by a Server.
+func LocalAddr(ctx context.Context) net.Addr {
+	var addr net.Addr
+
+	addr, _ = ctx.Value(localAddrKey).(net.Addr)
+	return addr
+}
+
+// RemoteAddr returns the address of the client that sent the request, or nil
+// if ctx does not belong to a request served by a Server.
+func RemoteAddr(ctx context.Context) net.Addr {
+	var addr net.Addr
+
+	addr, _ = ctx.Value(remoteAddrKey).(net.Addr)
+	return addr
+}
+
+// ShutdownStarted returns a channel that is closed once the server stops
+// accepting connections, so long-running handlers can wind down before
+// Shutdown gives up on them. It is nil, and so never ready, outside a Server.
+func ShutdownStarted(ctx context.Context) <-chan struct{} {
+	var done chan struct{}
+
+	done, _ = ctx.Value(shutdownKey).(chan struct{})
+	return done
+}
+
+// connContext returns the context shared by the requests on conn. It is
+// cancelled when the server is closed or Shutdown runs out of time.
+func (s *Server) connContext(conn net.Conn) context.Context {
+	var ctx context.Context
+
+	ctx = s.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	ctx = context.WithValue(ctx, localAddrKey, conn.LocalAddr())
+	ctx = context.WithValue(ctx, remoteAddrKey, conn.RemoteAddr())
+	if s.done != nil {
+		ctx = context.WithValue(ctx, shutdownKey, s.done)
+	}
+	return ctx
+}
+
+// requestContext returns the context for one request: it ends at the write
+// deadline, if there is one, and is cancelled once the request is served.
+func (s *Server) requestContext(connCtx context.Context) (context.Context, context.CancelCauseFunc) {
+	var (
+		ctx         context.Context
+		cancel      context.CancelCauseFunc
+		stopTimeout context.CancelFunc
+	)
+
+	ctx, cancel = context.WithCancelCause(connCtx)
+	if s.config.WriteTimeout <= 0 {
+		return ctx, cancel
+	}
+	ctx, stopTimeout = context.WithTimeout(ctx, s.config.WriteTimeout)
+	return ctx, func(cause error) {
+		stopTimeout()
+		cancel(cause)
+	}
+}
+
+// watchClose reads ahead on conn while the handler runs and calls cancel if
+// the client closes the connection. It only watches once the request has been
+// read in full, so no body bytes are taken from the handler; bytes of a
+// pipelined request stay pending in connReader. The returned function stops
+// the watch and restores readDeadline; it must be called before conn is read
+// again.
+func watchClose(conn net.Conn, connReader *request.Reader, req *request.Request, readDeadline time.Time,
+	cancel context.CancelCauseFunc) func() {
+	var done chan struct{}
+
+	if !req.BodyDone() {
+		return func() {}
+	}
+	done = make(chan struct{})
+	go func() {
+		var err error
+
+		defer close(done)
+		err = connReader.Wait()
+		if err != nil && !errors.Is(err, os.ErrDeadlineExceeded) {
+			cancel(ErrClientClosed)
+		}
+	}()
+	return func() {
+		// A deadline in the past wakes up the pending read.
+		_ = conn.SetReadDeadline(time.Unix(1, 0))
+		<-done
+		_ = conn.SetReadDeadline(readDeadline)
+	}
+}
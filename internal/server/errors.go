@@ -0,0 +1,108 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"runtime/debug"
+	"strconv"
+
+	"github.com/RegistersNinja/httpfromtcp/internal/request"
+	"github.com/RegistersNinja/httpfromtcp/internal/response"
+)
+
+// HandlerError is an error that carries the status to answer with. Message is
+// sent to the client, so it should not reveal internals.
+type HandlerError struct {
+	StatusCode response.StatusCode
+	Message    string
+}
+
+func (e *HandlerError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("error: status %d", e.StatusCode)
+	}
+	return fmt.Sprintf("error: status %d: %s", e.StatusCode, e.Message)
+}
+
+// ErrorHandler is a handler that reports failure by returning an error: a
+// *HandlerError is answered with its status and message, any other error with
+// 500 and no details. Its Serve and With methods turn it into a Handler.
+type ErrorHandler func(w *response.Writer, req *request.Request) error
+
+// ErrorPage renders the response for a failed request. It is only called while
+// nothing of the response has been sent.
+type ErrorPage func(w *response.Writer, req *request.Request, herr *HandlerError)
+
+// Serve runs h, answering a returned error with DefaultErrorPage.
+func (h ErrorHandler) Serve(w *response.Writer, req *request.Request) {
+	h.With(nil)(w, req)
+}
+
+// With returns a Handler that runs h and answers a returned error with page,
+// or DefaultErrorPage if page is nil. Once part of the response went out the
+// status can no longer change, so the error is only logged.
+func (h ErrorHandler) With(page ErrorPage) Handler {
+	return func(w *response.Writer, req *request.Request) {
+		var (
+			err  error
+			herr *HandlerError
+			ok   bool
+		)
+
+		err = h(w, req)
+		herr, ok = err.(*HandlerError)
+		if err == nil || (ok && herr == nil) {
+			return
+		}
+		log.Printf("error serving %s %s: %v", req.RequestLine.Method, req.RequestLine.RequestTarget, err)
+		if !errors.As(err, &herr) || herr == nil {
+			herr = &HandlerError{StatusCode: response.StatusInternalServerError}
+		}
+		renderError(w, req, page, herr)
+	}
+}
+
+// DefaultErrorPage answers with a short plain-text body naming the status,
+// followed by the message if there is one.
+func DefaultErrorPage(w *response.Writer, req *request.Request, herr *HandlerError) {
+	var body string
+
+	body = strconv.Itoa(int(herr.StatusCode)) + " " + response.StatusText(herr.StatusCode)
+	if herr.Message != "" {
+		body += ": " + herr.Message
+	}
+	writeStatusBody(w, herr.StatusCode, []byte(body), nil)
+}
+
+// serveHandler runs h, turning a panic into a 500 response rendered by page.
+// Once part of the response went out the status can no longer change, so the
+// panic is only logged. A panic always closes the connection, as the handler
+// may have left the request half read.
+func serveHandler(h Handler, page ErrorPage, w *response.Writer, req *request.Request) {
+	defer func() {
+		var v any
+
+		v = recover()
+		if v == nil {
+			return
+		}
+		log.Printf("panic serving %s %s: %v\n%s", req.RequestLine.Method, req.RequestLine.RequestTarget, v, debug.Stack())
+		w.CloseAfterResponse()
+		renderError(w, req, page, &HandlerError{StatusCode: response.StatusInternalServerError})
+	}()
+
+	h(w, req)
+}
+
+// renderError answers herr with page, or DefaultErrorPage if page is nil,
+// unless part of the response was already sent.
+func renderError(w *response.Writer, req *request.Request, page ErrorPage, herr *HandlerError) {
+	if w.Written() {
+		return
+	}
+	if page == nil {
+		page = DefaultErrorPage
+	}
+	page(w, req, herr)
+}
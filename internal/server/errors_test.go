@@ -0,0 +1,136 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/RegistersNinja/httpfromtcp/internal/request"
+	"github.com/RegistersNinja/httpfromtcp/internal/response"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServeHandlerErrors(t *testing.T) {
+	tests := []struct {
+		name      string
+		handler   Handler
+		status    int
+		body      string
+		closeConn bool
+	}{
+		{
+			name: "Handler Error",
+			handler: ErrorHandler(func(w *response.Writer, req *request.Request) error {
+				return &HandlerError{StatusCode: response.StatusNotFound, Message: "no such widget"}
+			}).Serve,
+			status: 404,
+			body:   "404 Not Found: no such widget",
+		},
+		{
+			name: "Wrapped Handler Error",
+			handler: ErrorHandler(func(w *response.Writer, req *request.Request) error {
+				return errors.Join(errors.New("lookup failed"), &HandlerError{StatusCode: response.StatusConflict})
+			}).Serve,
+			status: 409,
+			body:   "409 Conflict",
+		},
+		{
+			name: "Plain Error",
+			handler: ErrorHandler(func(w *response.Writer, req *request.Request) error {
+				return errors.New("database password is hunter2")
+			}).Serve,
+			status: 500,
+			body:   "500 Internal Server Error",
+		},
+		{
+			name: "Typed Nil",
+			handler: ErrorHandler(func(w *response.Writer, req *request.Request) error {
+				var herr *HandlerError
+				writeStatus(w, response.StatusOK, nil)
+				return herr
+			}).Serve,
+			status: 200,
+			body:   "200 OK",
+		},
+		{
+			name: "Panic",
+			handler: func(w *response.Writer, req *request.Request) {
+				panic("boom")
+			},
+			status:    500,
+			body:      "500 Internal Server Error",
+			closeConn: true,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			req := newRequest(t)
+			var out bytes.Buffer
+			w := response.NewWriter(&out, req)
+			serveHandler(tc.handler, nil, w, req)
+
+			resp, err := http.ReadResponse(bufio.NewReader(&out), nil)
+			require.NoError(t, err)
+			assert.Equal(t, tc.status, resp.StatusCode)
+			body, err := io.ReadAll(resp.Body)
+			require.NoError(t, err)
+			assert.Equal(t, tc.body, string(body))
+			assert.Equal(t, tc.closeConn, resp.Close)
+			assert.Equal(t, tc.closeConn, w.ShouldClose())
+		})
+	}
+}
+
+func TestServeHandlerAfterWrite(t *testing.T) {
+	req := newRequest(t)
+	var out bytes.Buffer
+	w := response.NewWriter(&out, req)
+	handler := ErrorHandler(func(w *response.Writer, req *request.Request) error {
+		h := response.GetDefaultHeaders(10)
+		w.WriteStatusLine(response.StatusOK)
+		w.WriteHeaders(h)
+		w.WriteBody([]byte("half"))
+		return errors.New("lost the rest")
+	}).Serve
+
+	serveHandler(handler, nil, w, req)
+	assert.Contains(t, out.String(), "HTTP/1.1 200 OK\r\n")
+	assert.NotContains(t, out.String(), "500")
+	assert.True(t, w.ShouldClose())
+}
+
+func TestServeHandlerErrorPage(t *testing.T) {
+	req := newRequest(t)
+	var out bytes.Buffer
+	w := response.NewWriter(&out, req)
+	page := func(w *response.Writer, req *request.Request, herr *HandlerError) {
+		writeStatusBody(w, herr.StatusCode, []byte("<h1>oops</h1>"), nil)
+	}
+	handler := ErrorHandler(func(w *response.Writer, req *request.Request) error {
+		return &HandlerError{StatusCode: response.StatusForbidden}
+	}).With(page)
+
+	handler(w, req)
+	resp, err := http.ReadResponse(bufio.NewReader(&out), nil)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	body, _ := io.ReadAll(resp.Body)
+	assert.Equal(t, "<h1>oops</h1>", string(body))
+}
+
+func TestToHTTPErrorHandler(t *testing.T) {
+	handler := ErrorHandler(func(w *response.Writer, req *request.Request) error {
+		return &HandlerError{StatusCode: response.StatusConflict, Message: "already exists"}
+	}).Serve
+
+	rec := httptest.NewRecorder()
+	ToHTTP(handler).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, http.StatusConflict, rec.Code)
+	assert.Equal(t, "409 Conflict: already exists", rec.Body.String())
+}
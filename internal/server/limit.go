@@ -0,0 +1,120 @@
+package server
+
+import (
+	"errors"
+	"log"
+	"math"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/RegistersNinja/httpfromtcp/internal/headers"
+	"github.com/RegistersNinja/httpfromtcp/internal/request"
+	"github.com/RegistersNinja/httpfromtcp/internal/response"
+)
+
+const (
+	retryAfterHeader  string        = "Retry-After"
+	defaultRetryAfter time.Duration = time.Second
+	// rejectTimeout bounds how long a connection turned away under
+	// LimitReject may take to send its request and read the 503.
+	rejectTimeout   time.Duration = time.Second
+	minAcceptDelay  time.Duration = 5 * time.Millisecond
+	maxAcceptDelay  time.Duration = time.Second
+	acceptDelayStep int           = 2
+)
+
+// LimitMode decides what happens to connections beyond Config.MaxConns.
+type LimitMode int
+
+const (
+	// LimitQueue holds new connections back until a connection finishes,
+	// leaving them waiting in the listen backlog.
+	LimitQueue LimitMode = iota
+	// LimitReject accepts them and answers the first request with
+	// 503 Service Unavailable and Retry-After.
+	LimitReject
+)
+
+// acquireConn takes a connection slot, waiting for one under LimitQueue. It
+// reports false if the server was closed in the meantime.
+func (s *Server) acquireConn() bool {
+	if s.slots == nil {
+		return true
+	}
+	select {
+	case s.slots <- struct{}{}:
+		return true
+	case <-s.done:
+		return false
+	}
+}
+
+// tryAcquireConn takes a connection slot if one is free.
+func (s *Server) tryAcquireConn() bool {
+	if s.slots == nil {
+		return true
+	}
+	select {
+	case s.slots <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+func (s *Server) releaseConn() {
+	if s.slots != nil {
+		<-s.slots
+	}
+}
+
+// reject answers the request on conn with 503 and closes it. The request is
+// read first so the client is not reset while still sending it.
+func (s *Server) reject(conn net.Conn) {
+	var (
+		req      *request.Request
+		rpWriter *response.Writer
+		extra    *headers.Headers
+		wait     time.Duration
+	)
+
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(rejectTimeout))
+	req, _ = request.RequestFromReaderWithOptions(conn, request.Options{
+		Limits:  s.config.Limits,
+		Framing: s.config.Framing,
+	})
+	if req != nil {
+		_ = req.DiscardBody(maxDrainBytes)
+	}
+
+	wait = s.config.RetryAfter
+	if wait <= 0 {
+		wait = defaultRetryAfter
+	}
+	extra = headers.NewHeaders()
+	extra.Set(retryAfterHeader, strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	log.Printf("rejected connection from %s: %d connections open", conn.RemoteAddr(), s.config.MaxConns)
+	rpWriter = response.NewWriter(conn, req)
+	rpWriter.CloseAfterResponse()
+	writeStatus(rpWriter, response.StatusServiceUnavailable, extra)
+}
+
+// acceptBackoff returns how long to wait after a failed Accept before trying
+// again, doubling the previous delay, or false if err is not temporary.
+func acceptBackoff(err error, delay time.Duration) (time.Duration, bool) {
+	var (
+		netErr net.Error
+		ok     bool
+	)
+
+	ok = errors.As(err, &netErr)
+	if !ok || !netErr.Temporary() {
+		return 0, false
+	}
+	if delay == 0 {
+		return minAcceptDelay, true
+	}
+	return min(delay*time.Duration(acceptDelayStep), maxAcceptDelay), true
+}
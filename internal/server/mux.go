@@ -0,0 +1,110 @@
+package server
+
+import (
+	"strings"
+
+	"github.com/RegistersNinja/httpfromtcp/internal/headers"
+	"github.com/RegistersNinja/httpfromtcp/internal/request"
+	"github.com/RegistersNinja/httpfromtcp/internal/response"
+)
+
+const (
+	allowHeader    string = "Allow"
+	allowSeparator string = ", "
+	subtreeSuffix  string = "/"
+)
+
+// Mux routes requests by method and decoded path. A pattern ending in "/"
+// matches its whole subtree; otherwise the path has to match exactly. The
+// longest matching pattern wins. A path without a route is answered with 404,
+// a route without a handler for the method with 405 and an Allow header.
+type Mux struct {
+	routes []*route
+}
+
+type route struct {
+	pattern  string
+	methods  []string
+	handlers map[string]Handler
+}
+
+func NewMux() *Mux {
+	return &Mux{}
+}
+
+// Handle registers handler for method requests matching pattern. Registering
+// the same method and pattern twice replaces the earlier handler.
+func (m *Mux) Handle(method string, pattern string, handler Handler) {
+	var (
+		rt         *route
+		registered bool
+	)
+
+	rt = m.find(pattern)
+	if rt == nil {
+		rt = &route{pattern: pattern, handlers: map[string]Handler{}}
+		m.routes = append(m.routes, rt)
+	}
+	_, registered = rt.handlers[method]
+	if !registered {
+		rt.methods = append(rt.methods, method)
+	}
+	rt.handlers[method] = handler
+}
+
+func (m *Mux) find(pattern string) *route {
+	var rt *route
+
+	for _, rt = range m.routes {
+		if rt.pattern == pattern {
+			return rt
+		}
+	}
+	return nil
+}
+
+func (rt *route) matches(path string) bool {
+	if strings.HasSuffix(rt.pattern, subtreeSuffix) {
+		return strings.HasPrefix(path, rt.pattern)
+	}
+	return path == rt.pattern
+}
+
+func (m *Mux) match(path string) *route {
+	var (
+		rt   *route
+		best *route
+	)
+
+	for _, rt = range m.routes {
+		if rt.matches(path) && (best == nil || len(rt.pattern) > len(best.pattern)) {
+			best = rt
+		}
+	}
+	return best
+}
+
+// ServeRequest is a Handler dispatching to the registered routes; pass
+// mux.ServeRequest to Serve.
+func (m *Mux) ServeRequest(w *response.Writer, req *request.Request) {
+	var (
+		rt      *route
+		handler Handler
+		ok      bool
+		allow   *headers.Headers
+	)
+
+	rt = m.match(req.Path())
+	if rt == nil {
+		writeStatus(w, response.StatusNotFound, nil)
+		return
+	}
+	handler, ok = rt.handlers[req.RequestLine.Method]
+	if !ok {
+		allow = headers.NewHeaders()
+		allow.Set(allowHeader, strings.Join(rt.methods, allowSeparator))
+		writeStatus(w, response.StatusMethodNotAllowed, allow)
+		return
+	}
+	handler(w, req)
+}
@@ -0,0 +1,291 @@
+package server
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/RegistersNinja/httpfromtcp/internal/headers"
+	"github.com/RegistersNinja/httpfromtcp/internal/request"
+	"github.com/RegistersNinja/httpfromtcp/internal/response"
+)
+
+const (
+	acceptHeader          string  = "Accept"
+	acceptLanguageHeader  string  = "Accept-Language"
+	acceptEncodingHeader  string  = "Accept-Encoding"
+	varyHeader            string  = "Vary"
+	contentTypeHeader     string  = "Content-Type"
+	contentLanguageHeader string  = "Content-Language"
+	contentEncodingHeader string  = "Content-Encoding"
+	identityCoding        string  = "identity"
+	wildcard              string  = "*"
+	languageSeparator     string  = "-"
+	fullQuality           float64 = 1
+)
+
+// ErrNotAcceptable is returned by Negotiate when the request rules out every
+// offer.
+var ErrNotAcceptable = errors.New("error: no acceptable representation")
+
+// Offer is one representation a handler can produce. Empty fields do not take
+// part in negotiation; an empty Encoding means identity.
+type Offer struct {
+	ContentType string
+	Language    string
+	Encoding    string
+}
+
+// Negotiate picks the offer that best matches the request's Accept,
+// Accept-Language and Accept-Encoding fields (RFC 9110 section 12), weighing
+// each offer by the product of its three qualities. Ties go to the earlier
+// offer, so offers should be listed in the server's order of preference.
+//
+// Vary is added to h for every field that could change the outcome, and on
+// success h also gets the Content-Type, Content-Language and
+// Content-Encoding of the chosen offer. When nothing is acceptable the error
+// is ErrNotAcceptable and the handler should answer with NotAcceptable.
+func Negotiate(req *request.Request, offers []Offer, h *headers.Headers) (Offer, error) {
+	var (
+		accept    []headers.QualityValue
+		languages []headers.QualityValue
+		encodings []headers.QualityValue
+		offer     Offer
+		best      Offer
+		bestQ     float64
+		q         float64
+	)
+
+	accept = qualityList(req, acceptHeader)
+	languages = qualityList(req, acceptLanguageHeader)
+	encodings = qualityList(req, acceptEncodingHeader)
+	addVary(h, offers)
+
+	for _, offer = range offers {
+		q = mediaTypeQuality(accept, offer.ContentType) *
+			languageQuality(languages, offer.Language) *
+			encodingQuality(encodings, offer.Encoding)
+		if q > bestQ {
+			best, bestQ = offer, q
+		}
+	}
+	if bestQ == 0 {
+		return Offer{}, ErrNotAcceptable
+	}
+
+	if best.ContentType != "" {
+		h.Set(contentTypeHeader, best.ContentType)
+	}
+	if best.Language != "" {
+		h.Set(contentLanguageHeader, best.Language)
+	}
+	if best.Encoding != "" && !strings.EqualFold(best.Encoding, identityCoding) {
+		h.Set(contentEncodingHeader, best.Encoding)
+	}
+	return best, nil
+}
+
+// NotAcceptable answers 406, carrying over the Vary that Negotiate set on h;
+// the rest of h describes the representation that is not being sent.
+func NotAcceptable(w *response.Writer, h *headers.Headers) {
+	var (
+		extra *headers.Headers
+		value string
+	)
+
+	extra = headers.NewHeaders()
+	for _, value = range h.Values(varyHeader) {
+		extra.Add(varyHeader, value)
+	}
+	writeStatus(w, response.StatusNotAcceptable, extra)
+}
+
+// qualityList returns the preferences sent in name, or nil when the field is
+// absent. A malformed field is ignored, as RFC 9110 section 12.5 allows.
+func qualityList(req *request.Request, name string) []headers.QualityValue {
+	var (
+		values []string
+		list   []headers.QualityValue
+		err    error
+	)
+
+	values = req.Headers.Values(name)
+	if values == nil {
+		return nil
+	}
+	list, err = headers.ParseQualityList(strings.Join(values, ", "))
+	if err != nil {
+		return nil
+	}
+	if list == nil {
+		// An empty Accept-Encoding still means something: identity only.
+		return []headers.QualityValue{}
+	}
+	return list
+}
+
+// addVary lists in Vary the request fields whose value selects between
+// offers, skipping the ones every offer agrees on.
+func addVary(h *headers.Headers, offers []Offer) {
+	var (
+		varies []string
+		name   string
+		vary   string
+		found  bool
+	)
+
+	if differ(offers, func(o Offer) string { return strings.ToLower(o.ContentType) }) {
+		varies = append(varies, acceptHeader)
+	}
+	if differ(offers, func(o Offer) string { return strings.ToLower(o.Language) }) {
+		varies = append(varies, acceptLanguageHeader)
+	}
+	if differ(offers, func(o Offer) string { return normalizeCoding(o.Encoding) }) {
+		varies = append(varies, acceptEncodingHeader)
+	}
+	for _, name = range varies {
+		found = false
+		for _, vary = range h.List(varyHeader) {
+			if vary == wildcard || strings.EqualFold(vary, name) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			h.Add(varyHeader, name)
+		}
+	}
+}
+
+func differ(offers []Offer, key func(Offer) string) bool {
+	var offer Offer
+
+	for _, offer = range offers {
+		if key(offer) != key(offers[0]) {
+			return true
+		}
+	}
+	return false
+}
+
+func normalizeCoding(coding string) string {
+	if coding == "" {
+		return identityCoding
+	}
+	return strings.ToLower(coding)
+}
+
+// mediaTypeQuality returns the weight of the most specific media range in
+// accept that matches contentType (RFC 9110 section 12.5.1).
+func mediaTypeQuality(accept []headers.QualityValue, contentType string) float64 {
+	var (
+		offered     headers.MediaType
+		rng         headers.MediaType
+		qv          headers.QualityValue
+		param       headers.Param
+		value       string
+		q           float64
+		specificity int
+		best        int
+		matched     bool
+		err         error
+	)
+
+	if len(accept) == 0 || contentType == "" {
+		return fullQuality
+	}
+	offered, err = headers.ParseMediaType(contentType)
+	if err != nil {
+		return 0
+	}
+	best = -1
+	for _, qv = range accept {
+		rng, err = headers.ParseMediaType(qv.Value)
+		if err != nil || !offered.Matches(rng) {
+			continue
+		}
+		rng.Params = qv.Params
+		matched = true
+		for _, param = range rng.Params {
+			value, _ = offered.Param(param.Name)
+			if !strings.EqualFold(value, param.Value) {
+				matched = false
+				break
+			}
+		}
+		if !matched {
+			continue
+		}
+		specificity = len(rng.Params)
+		if rng.Subtype != wildcard {
+			specificity += 100
+		}
+		if rng.Type != wildcard {
+			specificity += 1000
+		}
+		if specificity > best {
+			best, q = specificity, qv.Q
+		}
+	}
+	return q
+}
+
+// languageQuality returns the weight of the longest language range in
+// languages that matches tag by basic filtering (RFC 4647 section 3.3.1).
+func languageQuality(languages []headers.QualityValue, tag string) float64 {
+	var (
+		qv   headers.QualityValue
+		q    float64
+		best int
+	)
+
+	if len(languages) == 0 || tag == "" {
+		return fullQuality
+	}
+	best = -1
+	for _, qv = range languages {
+		switch {
+		case qv.Value == wildcard:
+			if best < 0 {
+				best, q = 0, qv.Q
+			}
+		case strings.EqualFold(qv.Value, tag) ||
+			(len(tag) > len(qv.Value) && strings.EqualFold(tag[:len(qv.Value)], qv.Value) &&
+				strings.HasPrefix(tag[len(qv.Value):], languageSeparator)):
+			if len(qv.Value) > best {
+				best, q = len(qv.Value), qv.Q
+			}
+		}
+	}
+	return q
+}
+
+// encodingQuality returns the weight of coding in encodings (RFC 9110
+// section 12.5.3). identity stays acceptable unless it is excluded
+// explicitly or through "*;q=0".
+func encodingQuality(encodings []headers.QualityValue, coding string) float64 {
+	var (
+		qv        headers.QualityValue
+		wildcardQ float64
+		hasStar   bool
+	)
+
+	if encodings == nil {
+		return fullQuality
+	}
+	coding = normalizeCoding(coding)
+	for _, qv = range encodings {
+		if strings.EqualFold(qv.Value, coding) {
+			return qv.Q
+		}
+		if qv.Value == wildcard {
+			wildcardQ, hasStar = qv.Q, true
+		}
+	}
+	if hasStar {
+		return wildcardQ
+	}
+	if coding == identityCoding {
+		return fullQuality
+	}
+	return 0
+}
@@ -0,0 +1,128 @@
+package server
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/RegistersNinja/httpfromtcp/internal/headers"
+	"github.com/RegistersNinja/httpfromtcp/internal/request"
+	"github.com/RegistersNinja/httpfromtcp/internal/response"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newRequest(t *testing.T, fields ...string) *request.Request {
+	raw := "GET / HTTP/1.1\r\nHost: localhost\r\n"
+	for _, field := range fields {
+		raw += field + "\r\n"
+	}
+	req, err := request.RequestFromReader(strings.NewReader(raw + "\r\n"))
+	require.NoError(t, err)
+	return req
+}
+
+func TestNegotiate(t *testing.T) {
+	offers := []Offer{
+		{ContentType: "text/html; charset=utf-8", Language: "en-US"},
+		{ContentType: "application/json", Language: "en-US"},
+		{ContentType: "text/plain", Language: "de"},
+	}
+
+	tests := []struct {
+		name   string
+		fields []string
+		want   int
+	}{
+		{"No Preferences", nil, 0},
+		{"Exact Type", []string{"Accept: application/json"}, 1},
+		{"Weighted Types", []string{"Accept: text/html;q=0.5, application/json;q=0.9"}, 1},
+		{"More Specific Range Wins", []string{"Accept: text/*;q=0.1, text/plain, */*;q=0.2"}, 2},
+		{"Range Parameters", []string{"Accept: text/html;charset=latin1, text/plain;q=0.5"}, 2},
+		{"Language Prefix", []string{"Accept-Language: de;q=0.9, en;q=0.5"}, 2},
+		{"Language Wildcard", []string{"Accept-Language: fr, *;q=0.1"}, 0},
+		{"Qualities Multiply", []string{"Accept: application/json;q=0.4, text/plain;q=0.5", "Accept-Language: en-us, de;q=0.5"}, 1},
+		{"Malformed Field Ignored", []string{"Accept: text/plain;q=5"}, 0},
+		{"Multiple Lines", []string{"Accept: text/html;q=0.1", "Accept: application/json"}, 1},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			h := headers.NewHeaders()
+			got, err := Negotiate(newRequest(t, tc.fields...), offers, h)
+			require.NoError(t, err)
+			assert.Equal(t, offers[tc.want], got)
+			ct, _ := h.Get("Content-Type")
+			assert.Equal(t, offers[tc.want].ContentType, ct)
+			lang, _ := h.Get("Content-Language")
+			assert.Equal(t, offers[tc.want].Language, lang)
+			assert.Equal(t, []string{"Accept", "Accept-Language"}, h.Values("Vary"))
+		})
+	}
+
+	t.Run("Not Acceptable", func(t *testing.T) {
+		h := headers.NewHeaders()
+		_, err := Negotiate(newRequest(t, "Accept: image/png, text/*;q=0"), offers, h)
+		assert.ErrorIs(t, err, ErrNotAcceptable)
+		assert.Equal(t, []string{"Accept", "Accept-Language"}, h.Values("Vary"))
+		_, ok := h.Get("Content-Type")
+		assert.False(t, ok)
+	})
+
+	t.Run("Vary Not Duplicated", func(t *testing.T) {
+		h := headers.NewHeaders()
+		h.Add("Vary", "accept, Cookie")
+		_, err := Negotiate(newRequest(t), []Offer{{ContentType: "text/html"}, {ContentType: "text/plain"}}, h)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"accept, Cookie"}, h.Values("Vary"))
+	})
+}
+
+func TestNegotiateEncoding(t *testing.T) {
+	offers := []Offer{{Encoding: "br"}, {Encoding: "gzip"}, {}}
+
+	tests := []struct {
+		name   string
+		fields []string
+		want   int
+		ok     bool
+	}{
+		{"No Preferences", nil, 0, true},
+		{"Preferred Coding", []string{"Accept-Encoding: gzip, br;q=0.5"}, 1, true},
+		{"Identity Implied", []string{"Accept-Encoding: deflate"}, 2, true},
+		{"Empty Means Identity", []string{"Accept-Encoding:"}, 2, true},
+		{"Wildcard", []string{"Accept-Encoding: gzip;q=0.1, *;q=0.5"}, 0, true},
+		{"Identity Excluded", []string{"Accept-Encoding: identity;q=0, deflate"}, 0, false},
+		{"Everything Excluded", []string{"Accept-Encoding: *;q=0"}, 0, false},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			h := headers.NewHeaders()
+			got, err := Negotiate(newRequest(t, tc.fields...), offers, h)
+			if !tc.ok {
+				assert.ErrorIs(t, err, ErrNotAcceptable)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, offers[tc.want], got)
+			ce, ok := h.Get("Content-Encoding")
+			assert.Equal(t, offers[tc.want].Encoding != "", ok)
+			assert.Equal(t, offers[tc.want].Encoding, ce)
+			assert.Equal(t, []string{"Accept-Encoding"}, h.Values("Vary"))
+		})
+	}
+}
+
+func TestNotAcceptable(t *testing.T) {
+	var buf strings.Builder
+	w := response.NewWriter(&buf, nil)
+	h := response.GetDefaultHeaders(1234)
+	h.Add("Vary", "Accept")
+	h.Add("Vary", "Accept-Language")
+	NotAcceptable(w, h)
+	assert.Equal(t, "HTTP/1.1 406 Not Acceptable\r\n"+
+		"Content-Length: 18\r\n"+
+		"Content-Type: text/plain\r\n"+
+		"Vary: Accept, Accept-Language\r\n"+
+		"\r\n"+
+		"406 Not Acceptable", buf.String())
+}
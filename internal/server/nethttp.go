@@ -0,0 +1,438 @@
+package server
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/RegistersNinja/httpfromtcp/internal/headers"
+	"github.com/RegistersNinja/httpfromtcp/internal/request"
+	"github.com/RegistersNinja/httpfromtcp/internal/response"
+)
+
+const (
+	trailerHeader          string = "Trailer"
+	transferEncodingHeader string = "Transfer-Encoding"
+	contentLengthHeader    string = "Content-Length"
+	chunkedCoding          string = "chunked"
+	httpProtoPrefix        string = "HTTP/"
+	copyBufferSize         int    = 32 * 1024
+)
+
+// FromHTTP runs a net/http handler on this server. The request is translated
+// into an *http.Request whose Body streams the request body and whose Trailer
+// is filled in once the body has been read; the handler writes through an
+// http.ResponseWriter that also implements http.Flusher. Trailers are
+// announced and set the net/http way, with the "Trailer" header or
+// http.TrailerPrefix. Content sniffing is not done: set Content-Type
+// explicitly.
+func FromHTTP(h http.Handler) Handler {
+	return ResponseHandler(func(rw *response.ResponseWriter, req *request.Request) {
+		var (
+			httpReq *http.Request
+			w       *httpResponseWriter
+			err     error
+		)
+
+		httpReq, err = newHTTPRequest(req)
+		if err != nil {
+			log.Printf("error translating %s %s: %v", req.RequestLine.Method, req.RequestLine.RequestTarget, err)
+			rw.WriteHeader(response.StatusBadRequest)
+			return
+		}
+		w = &httpResponseWriter{rw: rw, header: http.Header{}}
+		h.ServeHTTP(w, httpReq)
+		w.finish()
+	}).Serve
+}
+
+// newHTTPRequest builds the *http.Request net/http would have produced for
+// req.
+func newHTTPRequest(req *request.Request) (*http.Request, error) {
+	var (
+		httpReq *http.Request
+		field   headers.Field
+		length  string
+		name    string
+		ok      bool
+		err     error
+	)
+
+	httpReq = &http.Request{
+		Method:     req.RequestLine.Method,
+		Proto:      httpProtoPrefix + req.RequestLine.HttpVersion,
+		ProtoMajor: 1,
+		Header:     http.Header{},
+		Trailer:    http.Header{},
+		Body:       http.NoBody,
+		RequestURI: req.RequestLine.RequestTarget,
+	}
+	httpReq = httpReq.WithContext(req.Context())
+	if req.RequestLine.HttpVersion == request.HTTPVersion11 {
+		httpReq.ProtoMinor = 1
+	}
+
+	switch req.Target.Form {
+	case request.AuthorityForm:
+		httpReq.URL = &url.URL{Host: req.RequestLine.RequestTarget}
+	default:
+		httpReq.URL, err = url.ParseRequestURI(req.RequestLine.RequestTarget)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for _, field = range req.Headers.Fields() {
+		switch {
+		case strings.EqualFold(field.Name, hostHeader):
+			httpReq.Host = field.Value
+		case strings.EqualFold(field.Name, trailerHeader):
+			for _, name = range headers.SplitList(field.Value) {
+				httpReq.Trailer[http.CanonicalHeaderKey(name)] = nil
+			}
+			httpReq.Header.Add(field.Name, field.Value)
+		default:
+			httpReq.Header.Add(field.Name, field.Value)
+		}
+	}
+	if httpReq.Host == "" {
+		httpReq.Host = httpReq.URL.Host
+	}
+
+	if len(req.Headers.Values(transferEncodingHeader)) > 0 {
+		httpReq.Header.Del(transferEncodingHeader)
+		httpReq.TransferEncoding = []string{chunkedCoding}
+		httpReq.ContentLength = -1
+		httpReq.Body = &trailerBody{req: req, httpReq: httpReq}
+		return httpReq, nil
+	}
+	length, ok = req.Headers.Get(contentLengthHeader)
+	if ok {
+		httpReq.ContentLength, _ = strconv.ParseInt(strings.TrimSpace(strings.Split(length, ",")[0]), 10, 64)
+	}
+	if httpReq.ContentLength > 0 {
+		httpReq.Body = req.BodyReader
+	}
+	if len(httpReq.Trailer) == 0 {
+		httpReq.Trailer = nil
+	}
+	return httpReq, nil
+}
+
+// trailerBody copies the request trailers into the *http.Request once the
+// chunked body has been read to the end, as net/http does.
+type trailerBody struct {
+	req     *request.Request
+	httpReq *http.Request
+}
+
+func (b *trailerBody) Read(p []byte) (int, error) {
+	var (
+		n     int
+		err   error
+		field headers.Field
+	)
+
+	n, err = b.req.BodyReader.Read(p)
+	if err == io.EOF && b.req.Trailers.Len() > 0 {
+		if b.httpReq.Trailer == nil {
+			b.httpReq.Trailer = http.Header{}
+		}
+		for _, field = range b.req.Trailers.Fields() {
+			b.httpReq.Trailer.Add(field.Name, field.Value)
+		}
+	}
+	return n, err
+}
+
+func (b *trailerBody) Close() error {
+	return b.req.BodyReader.Close()
+}
+
+// httpResponseWriter is the http.ResponseWriter handed to handlers run by
+// FromHTTP.
+type httpResponseWriter struct {
+	rw          *response.ResponseWriter
+	header      http.Header
+	wroteHeader bool
+}
+
+func (w *httpResponseWriter) Header() http.Header {
+	return w.header
+}
+
+// WriteHeader sends the status with the headers set so far. Informational
+// statuses are not supported and are ignored.
+func (w *httpResponseWriter) WriteHeader(code int) {
+	var (
+		key   string
+		value string
+	)
+
+	if w.wroteHeader || code < 200 {
+		return
+	}
+	w.wroteHeader = true
+	for _, key = range sortedKeys(w.header) {
+		if strings.HasPrefix(key, http.TrailerPrefix) {
+			continue
+		}
+		for _, value = range w.header[key] {
+			w.rw.Header().Add(key, value)
+		}
+	}
+	if w.header.Get(trailerHeader) != "" && w.header.Get(contentLengthHeader) == "" {
+		// Trailers need chunked framing.
+		w.rw.Header().Set(transferEncodingHeader, chunkedCoding)
+	}
+	w.rw.WriteHeader(response.StatusCode(code))
+}
+
+func (w *httpResponseWriter) Write(p []byte) (int, error) {
+	w.WriteHeader(http.StatusOK)
+	return w.rw.Write(p)
+}
+
+func (w *httpResponseWriter) ReadFrom(r io.Reader) (int64, error) {
+	w.WriteHeader(http.StatusOK)
+	return w.rw.ReadFrom(r)
+}
+
+func (w *httpResponseWriter) Flush() {
+	var err error
+
+	w.WriteHeader(http.StatusOK)
+	err = w.rw.Flush()
+	if err != nil {
+		log.Printf("error flushing response: %v", err)
+	}
+}
+
+// finish moves the trailer values the handler set into the response: the
+// fields announced in "Trailer" and any set with http.TrailerPrefix.
+func (w *httpResponseWriter) finish() {
+	var (
+		key   string
+		name  string
+		value string
+	)
+
+	w.WriteHeader(http.StatusOK)
+	for _, name = range headers.SplitList(strings.Join(w.header.Values(trailerHeader), ",")) {
+		for _, value = range w.header.Values(name) {
+			w.rw.Trailers().Add(http.CanonicalHeaderKey(name), value)
+		}
+	}
+	for _, key = range sortedKeys(w.header) {
+		if !strings.HasPrefix(key, http.TrailerPrefix) {
+			continue
+		}
+		for _, value = range w.header[key] {
+			w.rw.Trailers().Add(strings.TrimPrefix(key, http.TrailerPrefix), value)
+		}
+	}
+}
+
+func sortedKeys(h http.Header) []string {
+	var (
+		keys []string
+		key  string
+	)
+
+	for key = range h {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+// ToHTTP exposes h as an http.Handler, e.g. to test it with
+// net/http/httptest or mount it in a standard library server. The request is
+// re-encoded and parsed by this server's parser, and the response h writes is
+// decoded again, so the handler sees exactly what it would on the wire; bodies
+// and trailers are streamed in both directions.
+func ToHTTP(h Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var (
+			req      *request.Request
+			pr       *io.PipeReader
+			pw       *io.PipeWriter
+			rpWriter *response.Writer
+			encoded  io.Reader
+			stop     func()
+			done     chan struct{}
+			err      error
+		)
+
+		encoded, stop = encodeHTTPRequest(r)
+		defer stop()
+		req, err = request.RequestFromReader(encoded)
+		if err != nil {
+			http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+			return
+		}
+		req.SetContext(r.Context())
+
+		pr, pw = io.Pipe()
+		done = make(chan struct{})
+		go func() {
+			defer close(done)
+			copyHTTPResponse(w, pr, r)
+			// Keep draining so the handler never blocks on a response that
+			// could not be decoded.
+			_, _ = io.Copy(io.Discard, pr)
+		}()
+
+		rpWriter = response.NewWriter(pw, req)
+		serveHandler(h, DefaultErrorPage, rpWriter, req)
+		pw.Close()
+		<-done
+	})
+}
+
+// encodeHTTPRequest writes r back into HTTP/1.1 wire format. A body of unknown
+// length is sent chunked, followed by r.Trailer, by a goroutine; the returned
+// function stops it and waits for it to exit, whether or not the handler read
+// the whole body.
+func encodeHTTPRequest(r *http.Request) (io.Reader, func()) {
+	var (
+		head    strings.Builder
+		target  string
+		host    string
+		key     string
+		value   string
+		pr      *io.PipeReader
+		pw      *io.PipeWriter
+		encoded chan struct{}
+	)
+
+	target = r.RequestURI
+	if target == "" {
+		target = r.URL.RequestURI()
+	}
+	host = r.Host
+	if host == "" {
+		host = r.URL.Host
+	}
+	fmt.Fprintf(&head, "%s %s HTTP/1.1\r\n%s: %s\r\n", r.Method, target, hostHeader, host)
+	for _, key = range sortedKeys(r.Header) {
+		if strings.EqualFold(key, hostHeader) || strings.EqualFold(key, contentLengthHeader) || strings.EqualFold(key, transferEncodingHeader) {
+			continue
+		}
+		for _, value = range r.Header[key] {
+			fmt.Fprintf(&head, "%s: %s\r\n", key, value)
+		}
+	}
+
+	switch {
+	case r.Body == nil || r.Body == http.NoBody || r.ContentLength == 0:
+		head.WriteString("\r\n")
+		return strings.NewReader(head.String()), func() {}
+	case r.ContentLength > 0:
+		fmt.Fprintf(&head, "%s: %d\r\n\r\n", contentLengthHeader, r.ContentLength)
+		return io.MultiReader(strings.NewReader(head.String()), io.LimitReader(r.Body, r.ContentLength)), func() {}
+	}
+
+	fmt.Fprintf(&head, "%s: %s\r\n\r\n", transferEncodingHeader, chunkedCoding)
+	pr, pw = io.Pipe()
+	encoded = make(chan struct{})
+	go func() {
+		var (
+			chunked io.WriteCloser
+			err     error
+		)
+
+		defer close(encoded)
+		chunked = httputil.NewChunkedWriter(pw)
+		_, err = io.Copy(chunked, r.Body)
+		if err == nil {
+			err = chunked.Close()
+		}
+		if err == nil {
+			err = r.Trailer.Write(pw)
+		}
+		if err == nil {
+			_, err = io.WriteString(pw, "\r\n")
+		}
+		pw.CloseWithError(err)
+	}()
+	return io.MultiReader(strings.NewReader(head.String()), pr), func() {
+		// Unblock the goroutine whether it waits to write the unread rest of
+		// the body or to read more of it from the client.
+		pr.CloseWithError(io.ErrClosedPipe)
+		r.Body.Close()
+		<-encoded
+	}
+}
+
+// hopByHop lists the fields that describe the connection rather than the
+// response, which the net/http server sets on its own.
+func hopByHop(key string) bool {
+	return slices.ContainsFunc([]string{connectionHeader, transferEncodingHeader, "Keep-Alive", trailerHeader}, func(name string) bool {
+		return strings.EqualFold(key, name)
+	})
+}
+
+// copyHTTPResponse decodes the response written to src and replays it on w,
+// flushing after every read so streamed bodies stay streamed.
+func copyHTTPResponse(w http.ResponseWriter, src io.Reader, r *http.Request) {
+	var (
+		resp     *http.Response
+		flusher  http.Flusher
+		canFlush bool
+		buf      []byte
+		n        int
+		key      string
+		value    string
+		err      error
+	)
+
+	resp, err = http.ReadResponse(bufio.NewReader(src), r)
+	if err != nil {
+		log.Printf("error decoding response to %s %s: %v", r.Method, r.URL, err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	defer resp.Body.Close()
+
+	for key = range resp.Trailer {
+		w.Header().Add(trailerHeader, key)
+	}
+	for key = range resp.Header {
+		if hopByHop(key) {
+			continue
+		}
+		for _, value = range resp.Header[key] {
+			w.Header().Add(key, value)
+		}
+	}
+	w.WriteHeader(resp.StatusCode)
+
+	flusher, canFlush = w.(http.Flusher)
+	buf = make([]byte, copyBufferSize)
+	for {
+		n, err = resp.Body.Read(buf)
+		if n > 0 {
+			_, _ = w.Write(buf[:n])
+			if canFlush {
+				flusher.Flush()
+			}
+		}
+		if err != nil {
+			break
+		}
+	}
+
+	for key = range resp.Trailer {
+		for _, value = range resp.Trailer[key] {
+			w.Header().Add(key, value)
+		}
+	}
+}
@@ -0,0 +1,159 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/RegistersNinja/httpfromtcp/internal/request"
+	"github.com/RegistersNinja/httpfromtcp/internal/response"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFromHTTP(t *testing.T) {
+	raw := "POST /echo?x=1 HTTP/1.1\r\n" +
+		"Host: example.com\r\n" +
+		"Transfer-Encoding: chunked\r\n" +
+		"Trailer: X-Sum\r\n" +
+		"\r\n" +
+		"5\r\nhello\r\n0\r\nX-Sum: 42\r\n\r\n"
+	req, err := request.RequestFromReader(strings.NewReader(raw))
+	require.NoError(t, err)
+
+	handler := FromHTTP(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "example.com", r.Host)
+		assert.Equal(t, "/echo", r.URL.Path)
+		assert.Equal(t, "1", r.URL.Query().Get("x"))
+		assert.Equal(t, int64(-1), r.ContentLength)
+		body, err := io.ReadAll(r.Body)
+		assert.NoError(t, err)
+		assert.Equal(t, "hello", string(body))
+		assert.Equal(t, "42", r.Trailer.Get("X-Sum"))
+
+		w.Header().Set("Content-Type", "text/plain")
+		w.Header().Set("Trailer", "X-Echo")
+		w.WriteHeader(http.StatusCreated)
+		w.Write(body)
+		w.(http.Flusher).Flush()
+		w.Write(body)
+		w.Header().Set("X-Echo", "done")
+		w.Header().Set(http.TrailerPrefix+"X-Late", "yes")
+	}))
+
+	var out bytes.Buffer
+	handler(response.NewWriter(&out, req), req)
+
+	resp, err := http.ReadResponse(bufio.NewReader(&out), nil)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	assert.Equal(t, "text/plain", resp.Header.Get("Content-Type"))
+	assert.Equal(t, []string{"chunked"}, resp.TransferEncoding)
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, "hellohello", string(body))
+	assert.Equal(t, "done", resp.Trailer.Get("X-Echo"))
+	assert.Equal(t, "yes", resp.Trailer.Get("X-Late"))
+}
+
+func TestFromHTTPImplicitStatus(t *testing.T) {
+	req := newRequest(t)
+	handler := FromHTTP(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.NoBody, r.Body)
+		io.WriteString(w, "ok")
+	}))
+
+	var out bytes.Buffer
+	handler(response.NewWriter(&out, req), req)
+
+	resp, err := http.ReadResponse(bufio.NewReader(&out), nil)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, int64(2), resp.ContentLength)
+}
+
+func TestToHTTP(t *testing.T) {
+	handler := ResponseHandler(func(w *response.ResponseWriter, req *request.Request) {
+		body, err := io.ReadAll(req.BodyReader)
+		assert.NoError(t, err)
+		sum, _ := req.Trailers.Get("X-Sum")
+		w.Header().Set("Content-Type", "text/plain")
+		w.Header().Set("Transfer-Encoding", "chunked")
+		w.Header().Set("Trailer", "X-Echo")
+		w.WriteHeader(response.StatusOK)
+		w.Write(body)
+		w.Trailers().Set("X-Echo", sum)
+	}).Serve
+
+	rec := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPost, "/echo", io.NopCloser(strings.NewReader("hello")))
+	r.ContentLength = -1
+	r.Trailer = http.Header{"X-Sum": {"42"}}
+	ToHTTP(handler).ServeHTTP(rec, r)
+
+	resp := rec.Result()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/plain", resp.Header.Get("Content-Type"))
+	assert.Empty(t, resp.Header.Get("Transfer-Encoding"))
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(body))
+	assert.Equal(t, "42", resp.Trailer.Get("X-Echo"))
+}
+
+func TestToHTTPStreaming(t *testing.T) {
+	release := make(chan struct{})
+	handler := ResponseHandler(func(w *response.ResponseWriter, req *request.Request) {
+		w.Write([]byte("first\n"))
+		w.Flush()
+		<-release
+		w.Write([]byte("second\n"))
+	}).Serve
+
+	srv := httptest.NewServer(ToHTTP(handler))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	body := bufio.NewReader(resp.Body)
+	line, err := body.ReadString('\n')
+	require.NoError(t, err)
+	assert.Equal(t, "first\n", line)
+	close(release)
+	line, err = body.ReadString('\n')
+	require.NoError(t, err)
+	assert.Equal(t, "second\n", line)
+}
+
+func TestToHTTPBadRequest(t *testing.T) {
+	handler := func(w *response.Writer, req *request.Request) {
+		t.Error("handler called for an invalid request")
+	}
+
+	rec := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("Bad Name", "x")
+	ToHTTP(handler).ServeHTTP(rec, r)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestToHTTPUnreadChunkedBody(t *testing.T) {
+	handler := ToHTTP(okHandler)
+	before := runtime.NumGoroutine()
+	for range 20 {
+		rec := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodPost, "/", io.NopCloser(strings.NewReader(strings.Repeat("x", 1<<20))))
+		r.ContentLength = -1
+		handler.ServeHTTP(rec, r)
+		assert.Equal(t, http.StatusOK, rec.Code)
+	}
+	// The goroutines encoding the unread bodies are gone.
+	assert.LessOrEqual(t, runtime.NumGoroutine(), before+2)
+}
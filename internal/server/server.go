@@ -1,94 +1,586 @@
 package server
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io"
+	"log"
 	"net"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/RegistersNinja/httpfromtcp/internal/headers"
+	"github.com/RegistersNinja/httpfromtcp/internal/httperror"
 	"github.com/RegistersNinja/httpfromtcp/internal/request"
 	"github.com/RegistersNinja/httpfromtcp/internal/response"
 )
 
+const (
+	defaultMaxRequestsPerConn int           = 100
+	defaultIdleTimeout        time.Duration = 60 * time.Second
+	defaultReadHeaderTimeout  time.Duration = 10 * time.Second
+	maxDrainBytes             int64         = 256 * 1024
+	connectionHeader          string        = "Connection"
+	connectionClose           string        = "close"
+	connectionKeepAlive       string        = "keep-alive"
+	hostHeader                string        = "Host"
+	listSeparator             string        = ","
+)
+
+// ErrServerClosed is returned when a listener is added to a server that was
+// closed or shut down.
+var ErrServerClosed = errors.New("error: server closed")
+
+// supportedNetworks are the networks Server.Listen accepts.
+var supportedNetworks = []string{"tcp", "tcp4", "tcp6", "unix"}
+
 type Server struct {
-	listener net.Listener
-	closed   atomic.Bool
-	handler  Handler
+	closed  atomic.Bool
+	handler Handler
+	config  Config
+
+	mu        sync.Mutex
+	listeners []net.Listener
+	conns     map[net.Conn]connState
+	slots     chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+	ctx       context.Context
+	cancel    context.CancelCauseFunc
+}
+
+// Config controls how connections are reused. Zero values disable the
+// corresponding limit.
+type Config struct {
+	// MaxRequestsPerConn is the number of requests served on one connection
+	// before it is closed.
+	MaxRequestsPerConn int
+	// IdleTimeout is how long a persistent connection may wait for the next
+	// request. Zero means ReadTimeout is used instead.
+	IdleTimeout time.Duration
+	// ReadHeaderTimeout is how long a client has to send the request line and
+	// header fields, counted from the connection being accepted or, on a
+	// persistent connection, from the first byte of the request. A client
+	// that misses it gets 408 Request Timeout. Zero means ReadTimeout is used
+	// instead.
+	ReadHeaderTimeout time.Duration
+	// ReadTimeout is how long reading a whole request, body included, may
+	// take.
+	ReadTimeout time.Duration
+	// WriteTimeout is how long the response may take, counted from the end
+	// of the request headers; a write after it fails.
+	WriteTimeout time.Duration
+	// Limits bounds the size of each request the parser accepts.
+	Limits request.Limits
+	// Framing chooses between rejecting and repairing requests with
+	// conflicting Transfer-Encoding and Content-Length.
+	Framing request.FramingMode
+	// Methods lists the request methods the server implements; any other
+	// method is answered with 501 Not Implemented. Nil means DefaultMethods.
+	Methods []string
+	// ErrorPage renders the response when a handler panics. Nil means
+	// DefaultErrorPage. Errors returned by an ErrorHandler are rendered by the
+	// page given to its With method.
+	ErrorPage ErrorPage
+	// MaxConns is the number of connections served at once, across all
+	// listeners.
+	MaxConns int
+	// ConnLimit chooses what happens to connections beyond MaxConns.
+	ConnLimit LimitMode
+	// RetryAfter is the delay announced to connections turned away under
+	// LimitReject, in whole seconds. Zero means one second.
+	RetryAfter time.Duration
 }
 
 type Handler func(w *response.Writer, req *request.Request)
 
-type HandlerError struct {
-	StatusCode response.StatusCode
-	Message    string
+// ResponseHandler is a handler written against the net/http-style
+// response.ResponseWriter. Its Serve method is a Handler.
+type ResponseHandler func(w *response.ResponseWriter, req *request.Request)
+
+// Serve runs h with a ResponseWriter over w and completes the response once h
+// returns.
+func (h ResponseHandler) Serve(w *response.Writer, req *request.Request) {
+	var (
+		rw  *response.ResponseWriter
+		err error
+	)
+
+	rw = response.NewResponseWriter(w)
+	h(rw, req)
+	err = rw.Close()
+	if err != nil {
+		log.Printf("error completing response to %s %s: %v", req.RequestLine.Method, req.RequestLine.RequestTarget, err)
+	}
+}
+
+// DefaultMethods are the methods of RFC 9110 section 9 plus PATCH.
+func DefaultMethods() []string {
+	return []string{"GET", "HEAD", "POST", "PUT", "DELETE", "CONNECT", "OPTIONS", "TRACE", "PATCH"}
+}
+
+func DefaultConfig() Config {
+	return Config{
+		MaxRequestsPerConn: defaultMaxRequestsPerConn,
+		IdleTimeout:        defaultIdleTimeout,
+		ReadHeaderTimeout:  defaultReadHeaderTimeout,
+		Limits:             request.DefaultLimits(),
+	}
 }
 
 func Serve(port int, handleFunc Handler) (*Server, error) {
+	return ServeConfig(port, handleFunc, DefaultConfig())
+}
+
+func ServeConfig(port int, handleFunc Handler, config Config) (*Server, error) {
 	var (
-		listener net.Listener
-		err      error
-		s        *Server
+		s   *Server
+		err error
 	)
 
-	listener, err = net.Listen("tcp", fmt.Sprintf(":%d", port))
+	s = NewServer(handleFunc, config)
+	err = s.Listen("tcp", fmt.Sprintf(":%d", port))
 	if err != nil {
 		return nil, err
 	}
-	s = &Server{listener: listener, handler: handleFunc}
-	go s.listen()
 	return s, nil
 }
 
+// ServeListener serves requests accepted on listener with the default
+// configuration.
+func ServeListener(listener net.Listener, handleFunc Handler) (*Server, error) {
+	var (
+		s   *Server
+		err error
+	)
+
+	s = NewServer(handleFunc, DefaultConfig())
+	err = s.AddListener(listener)
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// ServeAddr listens on address and serves requests with the default
+// configuration; see Server.Listen for the networks it accepts.
+func ServeAddr(network string, address string, handleFunc Handler) (*Server, error) {
+	var (
+		s   *Server
+		err error
+	)
+
+	s = NewServer(handleFunc, DefaultConfig())
+	err = s.Listen(network, address)
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// NewServer returns a Server that does not listen anywhere yet; it starts
+// serving once Listen or AddListener is called, and can serve on any number of
+// listeners at once.
+func NewServer(handleFunc Handler, config Config) *Server {
+	var s *Server
+
+	s = &Server{handler: handleFunc, config: config, done: make(chan struct{})}
+	s.ctx, s.cancel = context.WithCancelCause(context.Background())
+	if config.MaxConns > 0 {
+		s.slots = make(chan struct{}, config.MaxConns)
+	}
+	return s
+}
+
+// Listen listens on address and serves the connections accepted there.
+// network is one of "tcp", "tcp4", "tcp6" or "unix"; for the TCP networks
+// address is "host:port", where an empty host means all interfaces, and for
+// "unix" it is the path of the socket, which is removed again on Close.
+func (s *Server) Listen(network string, address string) error {
+	var (
+		listener net.Listener
+		err      error
+	)
+
+	if !slices.Contains(supportedNetworks, network) {
+		return fmt.Errorf("error: unsupported network %q", network)
+	}
+	listener, err = net.Listen(network, address)
+	if err != nil {
+		return err
+	}
+	err = s.AddListener(listener)
+	if err != nil {
+		listener.Close()
+	}
+	return err
+}
+
+// AddListener serves the connections accepted on listener, in addition to
+// any the server already listens on. The server takes ownership of listener
+// and closes it on Close or Shutdown.
+func (s *Server) AddListener(listener net.Listener) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed.Load() {
+		return ErrServerClosed
+	}
+	s.listeners = append(s.listeners, listener)
+	go s.listen(listener)
+	return nil
+}
+
+// Addrs returns the addresses the server listens on.
+func (s *Server) Addrs() []net.Addr {
+	var (
+		addrs    []net.Addr
+		listener net.Listener
+	)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, listener = range s.listeners {
+		addrs = append(addrs, listener.Addr())
+	}
+	return addrs
+}
+
 func (s *Server) Close() error {
 	if s == nil {
 		return nil
 	}
+	s.markClosed()
+	s.cancelRequests()
+	return s.closeListeners()
+}
+
+// cancelRequests cancels the context of every request in progress.
+func (s *Server) cancelRequests() {
+	if s.cancel != nil {
+		s.cancel(ErrServerClosed)
+	}
+}
+
+// markClosed stops the server from accepting connections.
+func (s *Server) markClosed() {
 	s.closed.Store(true)
-	if s.listener != nil {
-		return s.listener.Close()
+	s.closeOnce.Do(func() {
+		if s.done != nil {
+			close(s.done)
+		}
+	})
+}
+
+// closeListeners closes every listener and returns the first error other
+// than one having been closed already.
+func (s *Server) closeListeners() error {
+	var (
+		listener net.Listener
+		err      error
+		firstErr error
+	)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, listener = range s.listeners {
+		err = listener.Close()
+		if err != nil && !errors.Is(err, net.ErrClosed) && firstErr == nil {
+			firstErr = err
+		}
 	}
-	return nil
+	return firstErr
 }
 
-func (s *Server) listen() {
+// listen accepts connections on listener until the server is closed. While
+// MaxConns connections are open it either holds the next one back, leaving
+// the rest in the listen backlog, or turns new ones away, and after a temporary error such as running out of file descriptors
+// it backs off exponentially instead of retrying at once.
+func (s *Server) listen(listener net.Listener) {
 	var (
-		conn net.Conn
-		err  error
+		conn  net.Conn
+		delay time.Duration
+		ok    bool
+		err   error
 	)
 
 	for {
-		conn, err = s.listener.Accept()
+		conn, err = listener.Accept()
 		if err != nil {
-			if s.closed.Load() {
+			if s.closed.Load() || errors.Is(err, net.ErrClosed) {
+				return
+			}
+			delay, ok = acceptBackoff(err, delay)
+			if !ok {
+				log.Printf("error accepting on %s: %v", listener.Addr(), err)
+				return
+			}
+			log.Printf("error accepting on %s: %v; retrying in %v", listener.Addr(), err, delay)
+			select {
+			case <-time.After(delay):
+			case <-s.done:
 				return
 			}
 			continue
 		}
-		go s.handle(conn)
+		delay = 0
+		if s.config.ConnLimit == LimitReject {
+			if !s.tryAcquireConn() {
+				go s.reject(conn)
+				continue
+			}
+		} else if !s.acquireConn() {
+			conn.Close()
+			return
+		}
+		go s.serveConn(conn)
 	}
 }
 
+// serveConn handles conn and frees its connection slot afterwards.
+func (s *Server) serveConn(conn net.Conn) {
+	defer s.releaseConn()
+	s.handle(conn)
+}
+
+// handle serves requests from conn one after another until either side asks
+// to close it. Requests are read through one request.Reader so bytes of a
+// pipelined request that arrived early are kept for the next iteration, and
+// responses go out in request order.
 func (s *Server) handle(conn net.Conn) {
 	defer conn.Close()
+	if !s.trackConn(conn) {
+		return
+	}
+	defer s.untrackConn(conn)
 	var (
-		rpWriter *response.Writer
-		req      *request.Request
-		err      error
-		body     []byte
-		hdrs     headers.Headers
+		connReader *request.Reader
+		rpWriter   *response.Writer
+		req        *request.Request
+		start      time.Time
+		connCtx    context.Context
+		ctx        context.Context
+		cancel     context.CancelCauseFunc
+		stopWatch  func()
+		err        error
+		served     int
 	)
 
-	rpWriter = &response.Writer{Writer: conn}
+	connCtx = s.connContext(conn)
+	connReader = request.NewReader(conn)
+	for {
+		start = time.Now()
+		if served == 0 {
+			_ = conn.SetReadDeadline(s.headerDeadline(start))
+		} else {
+			_ = conn.SetReadDeadline(deadline(start, s.idleTimeout()))
+		}
+		_ = conn.SetWriteDeadline(time.Time{})
+		if !s.setConnState(conn, connIdle) {
+			return
+		}
+		err = connReader.Wait()
+		if err != nil {
+			// Nothing of a request arrived: close without answering.
+			return
+		}
+		s.setConnState(conn, connActive)
+		if served > 0 {
+			start = time.Now()
+			_ = conn.SetReadDeadline(s.headerDeadline(start))
+		}
 
-	req, err = request.RequestFromReader(conn)
-	if err != nil {
-		rpWriter.WriteStatusLine(response.StatusBadRequest)
-		body = []byte(err.Error())
-		hdrs = response.GetDefaultHeaders(len(body))
-		rpWriter.WriteHeaders(hdrs)
-		rpWriter.WriteBody(body)
+		req, err = request.RequestFromReaderWithOptions(connReader, request.Options{
+			Limits:  s.config.Limits,
+			Framing: s.config.Framing,
+		})
+		_ = conn.SetWriteDeadline(deadline(time.Now(), s.config.WriteTimeout))
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return
+			}
+			if errors.Is(err, os.ErrDeadlineExceeded) {
+				log.Printf("rejected request from %s: request headers not received in time", conn.RemoteAddr())
+				writeError(response.NewWriter(conn, nil), response.StatusRequestTimeout)
+				return
+			}
+			logRejected(conn, err)
+			writeError(response.NewWriter(conn, nil), statusForError(err))
+			return
+		}
+		_ = conn.SetReadDeadline(deadline(start, s.config.ReadTimeout))
+		served++
+
+		if req.RequestLine.HttpVersion == request.HTTPVersion11 && !hasHost(req) {
+			// RFC 9112 section 3.2: HTTP/1.1 requests must carry Host.
+			log.Printf("rejected request from %s: HTTP/1.1 request without Host", conn.RemoteAddr())
+			writeError(response.NewWriter(conn, req), response.StatusBadRequest)
+			return
+		}
+
+		rpWriter = response.NewWriter(conn, req)
+		if !s.implements(req.RequestLine.Method) {
+			writeStatus(rpWriter, response.StatusNotImplemented, nil)
+			if rpWriter.ShouldClose() || req.DiscardBody(maxDrainBytes) != nil {
+				return
+			}
+			continue
+		}
+		if wantsClose(req) || req.RequiresClose() || s.closed.Load() ||
+			(s.config.MaxRequestsPerConn > 0 && served >= s.config.MaxRequestsPerConn) {
+			rpWriter.CloseAfterResponse()
+		}
+
+		ctx, cancel = s.requestContext(connCtx)
+		req.SetContext(ctx)
+		stopWatch = watchClose(conn, connReader, req, deadline(start, s.config.ReadTimeout), cancel)
+		serveHandler(s.handler, s.config.ErrorPage, rpWriter, req)
+		stopWatch()
+		cancel(nil)
+
+		if !rpWriter.Written() && errors.Is(req.BodyErr(), request.ErrContentTooLarge) {
+			logRejected(conn, req.BodyErr())
+			writeError(rpWriter, response.StatusContentTooLarge)
+			return
+		}
+
+		if rpWriter.ShouldClose() {
+			return
+		}
+		err = req.DiscardBody(maxDrainBytes)
+		if err != nil {
+			return
+		}
+	}
+}
+
+// headerDeadline returns when the headers of a request started at start
+// have to be complete.
+func (s *Server) headerDeadline(start time.Time) time.Time {
+	if s.config.ReadHeaderTimeout > 0 {
+		return start.Add(s.config.ReadHeaderTimeout)
+	}
+	return deadline(start, s.config.ReadTimeout)
+}
+
+func (s *Server) idleTimeout() time.Duration {
+	if s.config.IdleTimeout > 0 {
+		return s.config.IdleTimeout
+	}
+	return s.config.ReadTimeout
+}
+
+// deadline returns start plus timeout, or no deadline for a zero timeout.
+func deadline(start time.Time, timeout time.Duration) time.Time {
+	if timeout <= 0 {
+		return time.Time{}
+	}
+	return start.Add(timeout)
+}
+
+func (s *Server) implements(method string) bool {
+	var methods []string
+
+	methods = s.config.Methods
+	if methods == nil {
+		methods = DefaultMethods()
+	}
+	return slices.Contains(methods, method)
+}
+
+// statusForError picks the status for a request the parser rejected.
+func statusForError(err error) response.StatusCode {
+	var perr *httperror.ParseError
+
+	if errors.As(err, &perr) {
+		return response.StatusCode(perr.StatusCode)
+	}
+	return response.StatusBadRequest
+}
+
+// logRejected keeps the parser's details in the server log; the client only
+// gets the status.
+func logRejected(conn net.Conn, err error) {
+	var perr *httperror.ParseError
+
+	if errors.As(err, &perr) {
+		log.Printf("rejected request from %s: status=%d reason=%s offset=%d: %s",
+			conn.RemoteAddr(), perr.StatusCode, perr.Reason, perr.Offset, perr.Detail)
 		return
 	}
+	log.Printf("rejected request from %s: %v", conn.RemoteAddr(), err)
+}
+
+// writeError answers a request that could not be served and closes the
+// connection, since the rest of the request may still be on the wire.
+func writeError(rpWriter *response.Writer, status response.StatusCode) {
+	rpWriter.CloseAfterResponse()
+	writeStatus(rpWriter, status, nil)
+}
+
+// writeStatus sends a short plain-text response naming status, with extra
+// headers, if any, sent along with the default ones.
+func writeStatus(rpWriter *response.Writer, status response.StatusCode, extra *headers.Headers) {
+	writeStatusBody(rpWriter, status, []byte(strconv.Itoa(int(status))+" "+response.StatusText(status)), extra)
+}
 
-	s.handler(rpWriter, req)
+// writeStatusBody sends status with a plain-text body.
+func writeStatusBody(rpWriter *response.Writer, status response.StatusCode, body []byte, extra *headers.Headers) {
+	var (
+		hdrs  *headers.Headers
+		field headers.Field
+	)
+
+	hdrs = response.GetDefaultHeaders(len(body))
+	if extra != nil {
+		for _, field = range extra.Fields() {
+			hdrs.Del(field.Name)
+		}
+		for _, field = range extra.Fields() {
+			hdrs.Add(field.Name, field.Value)
+		}
+	}
+	rpWriter.WriteStatusLine(status)
+	rpWriter.WriteHeaders(hdrs)
+	rpWriter.WriteBody(body)
+}
+
+func hasHost(req *request.Request) bool {
+	var ok bool
+
+	_, ok = req.Headers.Get(hostHeader)
+	return ok
+}
+
+func hasConnectionOption(req *request.Request, option string) bool {
+	var (
+		value string
+		token string
+	)
+
+	value, _ = req.Headers.Get(connectionHeader)
+	for _, token = range strings.Split(value, listSeparator) {
+		if strings.EqualFold(strings.TrimSpace(token), option) {
+			return true
+		}
+	}
+	return false
+}
+
+// wantsClose reports whether the client expects the connection to be closed
+// after this request: HTTP/1.1 connections persist unless "close" is sent,
+// HTTP/1.0 ones only persist when "keep-alive" is negotiated.
+func wantsClose(req *request.Request) bool {
+	if hasConnectionOption(req, connectionClose) {
+		return true
+	}
+	if req.RequestLine.HttpVersion == request.HTTPVersion10 {
+		return !hasConnectionOption(req, connectionKeepAlive)
+	}
+	return false
 }
@@ -0,0 +1,586 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/RegistersNinja/httpfromtcp/internal/request"
+	"github.com/RegistersNinja/httpfromtcp/internal/response"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// slowConn is the client end of a connection that sends one byte per delay,
+// the way a slowloris client does.
+type slowConn struct {
+	net.Conn
+	delay time.Duration
+}
+
+func (c *slowConn) Write(p []byte) (int, error) {
+	for i := range p {
+		time.Sleep(c.delay)
+		if _, err := c.Conn.Write(p[i : i+1]); err != nil {
+			return i, err
+		}
+	}
+	return len(p), nil
+}
+
+// serveConn runs a server with config and handler on one end of an in-memory
+// connection and returns the other end along with a channel closed once the
+// server is done with the connection.
+func serveConn(t *testing.T, config Config, handler Handler) (net.Conn, chan struct{}) {
+	server, client := net.Pipe()
+	done := make(chan struct{})
+	s := &Server{handler: handler, config: config}
+	go func() {
+		defer close(done)
+		s.handle(server)
+	}()
+	t.Cleanup(func() { client.Close() })
+	return client, done
+}
+
+func okHandler(w *response.Writer, req *request.Request) {
+	writeStatus(w, response.StatusOK, nil)
+}
+
+func waitDone(t *testing.T, done chan struct{}) {
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("connection was not closed")
+	}
+}
+
+func TestReadHeaderTimeout(t *testing.T) {
+	config := DefaultConfig()
+	config.ReadHeaderTimeout = 100 * time.Millisecond
+	client, done := serveConn(t, config, okHandler)
+
+	go (&slowConn{Conn: client, delay: 30 * time.Millisecond}).Write([]byte("GET / HTTP/1.1\r\nHost: localhost\r\n\r\n"))
+
+	resp, err := http.ReadResponse(bufio.NewReader(client), nil)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusRequestTimeout, resp.StatusCode)
+	assert.True(t, resp.Close)
+	_, err = io.Copy(io.Discard, resp.Body)
+	require.NoError(t, err)
+	waitDone(t, done)
+}
+
+func TestReadHeaderTimeoutSilentClient(t *testing.T) {
+	config := DefaultConfig()
+	config.ReadHeaderTimeout = 50 * time.Millisecond
+	client, done := serveConn(t, config, okHandler)
+
+	waitDone(t, done)
+	data, err := io.ReadAll(client)
+	assert.NoError(t, err)
+	assert.Empty(t, data)
+}
+
+func TestIdleTimeout(t *testing.T) {
+	config := DefaultConfig()
+	config.IdleTimeout = 50 * time.Millisecond
+	config.ReadHeaderTimeout = time.Second
+	client, done := serveConn(t, config, okHandler)
+
+	_, err := io.WriteString(client, "GET / HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	require.NoError(t, err)
+	reader := bufio.NewReader(client)
+	resp, err := http.ReadResponse(reader, nil)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	_, err = io.Copy(io.Discard, resp.Body)
+	require.NoError(t, err)
+
+	// The idle timeout closes the connection without an answer.
+	waitDone(t, done)
+	data, err := io.ReadAll(reader)
+	assert.NoError(t, err)
+	assert.Empty(t, data)
+}
+
+func TestIdleConnectionSlowRequest(t *testing.T) {
+	// A request that starts just before the idle timeout gets the full
+	// header timeout.
+	config := DefaultConfig()
+	config.IdleTimeout = 100 * time.Millisecond
+	config.ReadHeaderTimeout = time.Second
+	client, done := serveConn(t, config, okHandler)
+
+	go (&slowConn{Conn: client, delay: 10 * time.Millisecond}).Write([]byte(
+		"GET / HTTP/1.1\r\nHost: localhost\r\n\r\nGET / HTTP/1.1\r\nHost: localhost\r\nConnection: close\r\n\r\n"))
+
+	reader := bufio.NewReader(client)
+	for range 2 {
+		resp, err := http.ReadResponse(reader, nil)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		_, err = io.Copy(io.Discard, resp.Body)
+		require.NoError(t, err)
+	}
+	waitDone(t, done)
+}
+
+func TestReadTimeout(t *testing.T) {
+	config := DefaultConfig()
+	config.ReadTimeout = 100 * time.Millisecond
+	bodyErr := make(chan error, 1)
+	client, done := serveConn(t, config, func(w *response.Writer, req *request.Request) {
+		_, err := io.ReadAll(req.BodyReader)
+		bodyErr <- err
+		writeStatus(w, response.StatusOK, nil)
+	})
+
+	_, err := io.WriteString(client, "POST / HTTP/1.1\r\nHost: localhost\r\nContent-Length: 10\r\n\r\nab")
+	require.NoError(t, err)
+
+	select {
+	case err = <-bodyErr:
+		assert.Error(t, err)
+	case <-time.After(2 * time.Second):
+		t.Fatal("body read did not time out")
+	}
+	go io.Copy(io.Discard, client)
+	waitDone(t, done)
+}
+
+func TestWriteTimeout(t *testing.T) {
+	config := DefaultConfig()
+	config.WriteTimeout = 100 * time.Millisecond
+	writeErr := make(chan error, 1)
+	client, done := serveConn(t, config, func(w *response.Writer, req *request.Request) {
+		body := []byte(strings.Repeat("x", 1<<20))
+		w.WriteStatusLine(response.StatusOK)
+		w.WriteHeaders(response.GetDefaultHeaders(len(body)))
+		writeErr <- w.WriteBody(body)
+	})
+
+	// The client sends a request and never reads the response.
+	_, err := io.WriteString(client, "GET / HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	require.NoError(t, err)
+
+	select {
+	case err = <-writeErr:
+		assert.Error(t, err)
+	case <-time.After(2 * time.Second):
+		t.Fatal("write did not time out")
+	}
+	waitDone(t, done)
+}
+
+// startServer runs a server on a random local port and returns its address.
+func startServer(t *testing.T, handler Handler) (*Server, string) {
+	s, err := ServeConfig(0, handler, DefaultConfig())
+	require.NoError(t, err)
+	t.Cleanup(func() { s.Close() })
+	return s, s.Addrs()[0].String()
+}
+
+func TestShutdownIdle(t *testing.T) {
+	s, addr := startServer(t, okHandler)
+	conn, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	_, err = io.WriteString(conn, "GET / HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	require.NoError(t, err)
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, nil)
+	require.NoError(t, err)
+	_, err = io.Copy(io.Discard, resp.Body)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	require.NoError(t, s.Shutdown(ctx))
+
+	_, err = reader.ReadByte()
+	assert.ErrorIs(t, err, io.EOF)
+	_, err = net.Dial("tcp", addr)
+	assert.Error(t, err)
+}
+
+func TestShutdownDrainsActive(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	s, addr := startServer(t, func(w *response.Writer, req *request.Request) {
+		close(started)
+		<-release
+		writeStatus(w, response.StatusOK, nil)
+	})
+	conn, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer conn.Close()
+	_, err = io.WriteString(conn, "GET / HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	require.NoError(t, err)
+	<-started
+
+	shutdownErr := make(chan error, 1)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+		shutdownErr <- s.Shutdown(ctx)
+	}()
+	select {
+	case <-shutdownErr:
+		t.Fatal("Shutdown returned while a request was in progress")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(release)
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, nil)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	_, err = io.Copy(io.Discard, resp.Body)
+	require.NoError(t, err)
+	assert.NoError(t, <-shutdownErr)
+	_, err = reader.ReadByte()
+	assert.ErrorIs(t, err, io.EOF)
+}
+
+func TestShutdownDeadline(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	started := make(chan struct{})
+	s, addr := startServer(t, func(w *response.Writer, req *request.Request) {
+		close(started)
+		<-release
+	})
+	conn, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer conn.Close()
+	_, err = io.WriteString(conn, "GET / HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	require.NoError(t, err)
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, s.Shutdown(ctx), context.DeadlineExceeded)
+
+	// The connection was closed under the handler.
+	_, err = conn.Read(make([]byte, 1))
+	assert.Error(t, err)
+}
+
+// get sends a GET over conn and returns the status.
+func get(t *testing.T, conn net.Conn) int {
+	_, err := io.WriteString(conn, "GET / HTTP/1.1\r\nHost: localhost\r\nConnection: close\r\n\r\n")
+	require.NoError(t, err)
+	resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	require.NoError(t, err)
+	_, err = io.Copy(io.Discard, resp.Body)
+	require.NoError(t, err)
+	return resp.StatusCode
+}
+
+func TestServeListener(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	s, err := ServeListener(listener, okHandler)
+	require.NoError(t, err)
+	defer s.Close()
+
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+	assert.Equal(t, http.StatusOK, get(t, conn))
+}
+
+func TestServeMultipleListeners(t *testing.T) {
+	s := NewServer(okHandler, DefaultConfig())
+	defer s.Close()
+	socket := filepath.Join(t.TempDir(), "http.sock")
+	require.NoError(t, s.Listen("tcp4", "127.0.0.1:0"))
+	require.NoError(t, s.Listen("unix", socket))
+
+	addrs := s.Addrs()
+	require.Len(t, addrs, 2)
+	for _, addr := range addrs {
+		conn, err := net.Dial(addr.Network(), addr.String())
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusOK, get(t, conn), addr.Network())
+		conn.Close()
+	}
+
+	require.NoError(t, s.Close())
+	_, err := os.Stat(socket)
+	assert.ErrorIs(t, err, os.ErrNotExist)
+	assert.ErrorIs(t, s.Listen("tcp", "127.0.0.1:0"), ErrServerClosed)
+}
+
+func TestServeAddrUnsupportedNetwork(t *testing.T) {
+	_, err := ServeAddr("udp", "127.0.0.1:0", okHandler)
+	assert.Error(t, err)
+}
+
+// blockingHandler answers once release is closed, signalling on started when
+// it begins.
+func blockingHandler(started chan<- struct{}, release <-chan struct{}) Handler {
+	return func(w *response.Writer, req *request.Request) {
+		started <- struct{}{}
+		<-release
+		writeStatus(w, response.StatusOK, nil)
+	}
+}
+
+func startLimitedServer(t *testing.T, config Config, handler Handler) string {
+	s := NewServer(handler, config)
+	t.Cleanup(func() { s.Close() })
+	require.NoError(t, s.Listen("tcp", "127.0.0.1:0"))
+	return s.Addrs()[0].String()
+}
+
+func TestMaxConnsReject(t *testing.T) {
+	started := make(chan struct{}, 2)
+	release := make(chan struct{})
+	config := DefaultConfig()
+	config.MaxConns = 1
+	config.ConnLimit = LimitReject
+	config.RetryAfter = 1500 * time.Millisecond
+	addr := startLimitedServer(t, config, blockingHandler(started, release))
+
+	first, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer first.Close()
+	_, err = io.WriteString(first, "GET / HTTP/1.1\r\nHost: localhost\r\nConnection: close\r\n\r\n")
+	require.NoError(t, err)
+	<-started
+
+	second, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer second.Close()
+	_, err = io.WriteString(second, "GET / HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	require.NoError(t, err)
+	resp, err := http.ReadResponse(bufio.NewReader(second), nil)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+	assert.Equal(t, "2", resp.Header.Get("Retry-After"))
+	assert.True(t, resp.Close)
+
+	close(release)
+	resp, err = http.ReadResponse(bufio.NewReader(first), nil)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	// The slot is free again once the first connection is done.
+	assert.Eventually(t, func() bool {
+		conn, err := net.Dial("tcp", addr)
+		if err != nil {
+			return false
+		}
+		defer conn.Close()
+		return get(t, conn) == http.StatusOK
+	}, 2*time.Second, 20*time.Millisecond)
+}
+
+func TestMaxConnsQueue(t *testing.T) {
+	started := make(chan struct{}, 2)
+	release := make(chan struct{})
+	config := DefaultConfig()
+	config.MaxConns = 1
+	addr := startLimitedServer(t, config, blockingHandler(started, release))
+
+	first, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer first.Close()
+	_, err = io.WriteString(first, "GET / HTTP/1.1\r\nHost: localhost\r\nConnection: close\r\n\r\n")
+	require.NoError(t, err)
+	<-started
+
+	second, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer second.Close()
+	_, err = io.WriteString(second, "GET / HTTP/1.1\r\nHost: localhost\r\nConnection: close\r\n\r\n")
+	require.NoError(t, err)
+	select {
+	case <-started:
+		t.Fatal("second connection served beyond MaxConns")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	close(release)
+	for _, conn := range []net.Conn{first, second} {
+		resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+	}
+}
+
+type temporaryError struct{}
+
+func (temporaryError) Error() string   { return "too many open files" }
+func (temporaryError) Timeout() bool   { return false }
+func (temporaryError) Temporary() bool { return true }
+
+// failingListener fails every Accept with a temporary error.
+type failingListener struct {
+	net.Listener
+	accepts atomic.Int32
+}
+
+func (l *failingListener) Accept() (net.Conn, error) {
+	l.accepts.Add(1)
+	return nil, temporaryError{}
+}
+
+func TestAcceptBackoff(t *testing.T) {
+	delay, ok := acceptBackoff(temporaryError{}, 0)
+	assert.True(t, ok)
+	assert.Equal(t, minAcceptDelay, delay)
+	delay, _ = acceptBackoff(temporaryError{}, delay)
+	assert.Equal(t, 2*minAcceptDelay, delay)
+	delay, _ = acceptBackoff(temporaryError{}, maxAcceptDelay)
+	assert.Equal(t, maxAcceptDelay, delay)
+	_, ok = acceptBackoff(errors.New("bad file descriptor"), 0)
+	assert.False(t, ok)
+
+	inner, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	listener := &failingListener{Listener: inner}
+	s, err := ServeListener(listener, okHandler)
+	require.NoError(t, err)
+	time.Sleep(100 * time.Millisecond)
+	require.NoError(t, s.Close())
+	// 5, 10, 20 and 40ms apart rather than a busy loop.
+	assert.LessOrEqual(t, listener.accepts.Load(), int32(6))
+}
+
+func TestRequestContext(t *testing.T) {
+	type seen struct {
+		local, remote net.Addr
+		hasDeadline   bool
+		err           error
+	}
+	got := make(chan seen, 1)
+	config := DefaultConfig()
+	config.WriteTimeout = time.Minute
+	addr := startLimitedServer(t, config, func(w *response.Writer, req *request.Request) {
+		ctx := req.Context()
+		_, hasDeadline := ctx.Deadline()
+		got <- seen{LocalAddr(ctx), RemoteAddr(ctx), hasDeadline, ctx.Err()}
+		writeStatus(w, response.StatusOK, nil)
+	})
+
+	conn, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer conn.Close()
+	assert.Equal(t, http.StatusOK, get(t, conn))
+	s := <-got
+	assert.Equal(t, addr, s.local.String())
+	assert.Equal(t, conn.LocalAddr().String(), s.remote.String())
+	assert.True(t, s.hasDeadline)
+	assert.NoError(t, s.err)
+}
+
+func TestRequestContextClientClosed(t *testing.T) {
+	cause := make(chan error, 1)
+	addr := startLimitedServer(t, DefaultConfig(), func(w *response.Writer, req *request.Request) {
+		select {
+		case <-req.Context().Done():
+			cause <- context.Cause(req.Context())
+		case <-time.After(2 * time.Second):
+			cause <- nil
+		}
+	})
+
+	conn, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	_, err = io.WriteString(conn, "GET / HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	require.NoError(t, err)
+	time.Sleep(20 * time.Millisecond)
+	conn.Close()
+	assert.ErrorIs(t, <-cause, ErrClientClosed)
+}
+
+func TestRequestContextPipelined(t *testing.T) {
+	var served atomic.Int32
+	addr := startLimitedServer(t, DefaultConfig(), func(w *response.Writer, req *request.Request) {
+		if served.Add(1) == 1 {
+			time.Sleep(50 * time.Millisecond)
+		}
+		assert.NoError(t, req.Context().Err())
+		writeStatus(w, response.StatusOK, nil)
+	})
+
+	conn, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer conn.Close()
+	_, err = io.WriteString(conn, "GET / HTTP/1.1\r\nHost: localhost\r\n\r\n"+
+		"GET / HTTP/1.1\r\nHost: localhost\r\nConnection: close\r\n\r\n")
+	require.NoError(t, err)
+	reader := bufio.NewReader(conn)
+	for range 2 {
+		resp, err := http.ReadResponse(reader, nil)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		_, err = io.Copy(io.Discard, resp.Body)
+		require.NoError(t, err)
+	}
+	assert.Equal(t, int32(2), served.Load())
+}
+
+func TestRequestContextServerClosed(t *testing.T) {
+	started := make(chan struct{})
+	shutdown := make(chan struct{})
+	cause := make(chan error, 1)
+	s, addr := startServer(t, func(w *response.Writer, req *request.Request) {
+		close(started)
+		<-ShutdownStarted(req.Context())
+		close(shutdown)
+		<-req.Context().Done()
+		cause <- context.Cause(req.Context())
+	})
+	conn, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer conn.Close()
+	_, err = io.WriteString(conn, "GET / HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	require.NoError(t, err)
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, s.Shutdown(ctx), context.DeadlineExceeded)
+	<-shutdown
+	assert.ErrorIs(t, <-cause, ErrServerClosed)
+}
+
+func TestPipelinedHead(t *testing.T) {
+	mux := NewMux()
+	mux.Handle("GET", "/a", okHandler)
+	client, done := serveConn(t, DefaultConfig(), mux.ServeRequest)
+
+	go io.WriteString(client, "HEAD /nope HTTP/1.1\r\nHost: localhost\r\n\r\n"+
+		"HEAD /a HTTP/1.1\r\nHost: localhost\r\n\r\n"+
+		"GET /a HTTP/1.1\r\nHost: localhost\r\nConnection: close\r\n\r\n")
+
+	reader := bufio.NewReader(client)
+	for _, want := range []int{http.StatusNotFound, http.StatusMethodNotAllowed} {
+		resp, err := http.ReadResponse(reader, &http.Request{Method: http.MethodHead})
+		require.NoError(t, err)
+		assert.Equal(t, want, resp.StatusCode)
+		assert.False(t, resp.Close)
+	}
+	resp, err := http.ReadResponse(reader, nil)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, "200 OK", string(body))
+	waitDone(t, done)
+}
@@ -0,0 +1,111 @@
+package server
+
+import (
+	"context"
+	"net"
+	"time"
+)
+
+// shutdownPollInterval is how often Shutdown checks whether the remaining
+// connections have finished.
+const shutdownPollInterval time.Duration = 10 * time.Millisecond
+
+// connState tells whether a connection is waiting for a request or serving
+// one.
+type connState int
+
+const (
+	connIdle connState = iota
+	connActive
+)
+
+// Shutdown stops the server gracefully: it stops accepting connections,
+// closes the ones waiting for a request and waits for the others to finish
+// the request in progress, closing them after it. Handlers can notice it
+// through ShutdownStarted. If ctx ends first, the remaining requests' contexts
+// are cancelled, their connections closed and ctx's error is returned.
+func (s *Server) Shutdown(ctx context.Context) error {
+	var (
+		ticker *time.Ticker
+		err    error
+	)
+
+	s.markClosed()
+	err = s.closeListeners()
+
+	ticker = time.NewTicker(shutdownPollInterval)
+	defer ticker.Stop()
+	for {
+		if s.closeIdleConns() {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			s.cancelRequests()
+			s.closeAllConns()
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// trackConn registers a new connection, or reports false once the server is
+// shutting down.
+func (s *Server) trackConn(conn net.Conn) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed.Load() {
+		return false
+	}
+	if s.conns == nil {
+		s.conns = make(map[net.Conn]connState)
+	}
+	s.conns[conn] = connIdle
+	return true
+}
+
+func (s *Server) untrackConn(conn net.Conn) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.conns, conn)
+}
+
+// setConnState records what conn is doing. It reports false when conn goes
+// idle during shutdown, in which case it should be closed.
+func (s *Server) setConnState(conn net.Conn, state connState) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if state == connIdle && s.closed.Load() {
+		return false
+	}
+	s.conns[conn] = state
+	return true
+}
+
+// closeIdleConns closes the connections waiting for a request and reports
+// whether no connections are left.
+func (s *Server) closeIdleConns() bool {
+	var (
+		conn  net.Conn
+		state connState
+	)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for conn, state = range s.conns {
+		if state == connIdle {
+			_ = conn.Close()
+		}
+	}
+	return len(s.conns) == 0
+}
+
+func (s *Server) closeAllConns() {
+	var conn net.Conn
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for conn = range s.conns {
+		_ = conn.Close()
+	}
+}